@@ -1,50 +1,131 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"flag"
 	"fmt"
 	"log"
 	"os"
+	"strings"
 
 	"csvsql/config"
 	"csvsql/internal/database"
 	"csvsql/internal/importer"
 	"csvsql/internal/mapping"
 	"csvsql/internal/repl"
-
-	_ "github.com/mattn/go-sqlite3"
+	"csvsql/pkg/utils"
 )
 
 func main() {
 
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "Usage: csvsql [options] <file1.csv> [file2.xlsx] ...")
+		flag.PrintDefaults()
+	}
+	flag.BoolVar(&config.Gcfg.Lenient, "lenient", config.Gcfg.Lenient, "tolerate malformed CSV rows and record them in the _rejects table")
+	flag.StringVar(&config.Gcfg.FixedSpec, "fixed-spec", config.Gcfg.FixedSpec, "column spec for fixed-width .txt/.dat/.prn/.fwf files, e.g. \"name:1-10,amount:11-20\", or a spec file")
+	flag.StringVar(&config.Gcfg.LogPattern, "log-pattern", config.Gcfg.LogPattern, "regular expression with named groups for .log files, or a preset: "+strings.Join(importer.LogPresetNames(), ", "))
+	flag.StringVar(&config.Gcfg.XMLPath, "xml-path", config.Gcfg.XMLPath, "path of the repeating row element in .xml files, e.g. /Invoices/Invoice (default: children of the root)")
+	flag.BoolVar(&config.Gcfg.Watch, "watch", config.Gcfg.Watch, "reload tables automatically when their source files change")
+	flag.DurationVar(&config.Gcfg.WatchEvery, "watch-interval", config.Gcfg.WatchEvery, "how often source files are checked in watch mode")
+	flag.BoolFunc("replace", "re-import a changed file whose table already exists (default)", setImportPolicy(config.PolicyReplace))
+	flag.BoolFunc("append", "append the rows of a changed file to its existing table", setImportPolicy(config.PolicyAppend))
+	flag.BoolFunc("fail", "refuse to load a changed file whose table already exists", setImportPolicy(config.PolicyFail))
+	flag.StringVar(&config.Gcfg.Clean, "clean", config.Gcfg.Clean, "transforms applied to columns on import, e.g. \"*:trim,nfkc;金额:currency\", or a spec file; transforms: "+strings.Join(importer.TransformNames(), ", "))
+	flag.BoolVar(&config.Gcfg.DetectDates, "detect-dates", config.Gcfg.DetectDates, "convert columns holding only dates, such as 2024年3月5日, to ISO-8601")
+	flag.Func("date-formats", "comma-separated Go time layouts tried before the built-in date formats, e.g. \"02.01.2006\"", func(value string) error {
+		config.Gcfg.DateFormats = config.ParseList(value)
+		return nil
+	})
+	flag.StringVar(&config.Gcfg.TimeZone, "timezone", config.Gcfg.TimeZone, "time zone of imported times without an offset, e.g. Asia/Shanghai; times are written with their offset")
+	flag.Func("null-tokens", "comma-separated cell values imported as NULL, e.g. \",NA,N/A,-,无\" (a leading comma stands for empty cells)", func(value string) error {
+		config.Gcfg.NullTokens = config.ParseList(value)
+		return nil
+	})
+	flag.StringVar(&config.Gcfg.NullDisplay, "null-display", config.Gcfg.NullDisplay, "how NULL is shown in query results")
+	flag.StringVar(&config.Gcfg.NullExport, "null-export", config.Gcfg.NullExport, "how NULL is written by EXPORT")
+	flag.IntVar(&config.Gcfg.PageSize, "page-size", config.Gcfg.PageSize, "rows per page of query results in a terminal, 0 to turn the pager off")
+	flag.DurationVar(&config.Gcfg.QueryTimeout, "timeout", config.Gcfg.QueryTimeout, "interrupt statements running longer than this, e.g. 30s (default: no limit)")
+	flag.StringVar(&config.Gcfg.Collation, "collate", config.Gcfg.Collation, "sort imported columns with Chinese headers in pinyin or stroke order")
+	flag.Parse()
+	if config.Gcfg.WatchEvery <= 0 {
+		fmt.Fprintf(flag.CommandLine.Output(), "invalid value %s for flag -watch-interval: must be positive, e.g. 2s\n", config.Gcfg.WatchEvery)
+		os.Exit(2)
+	}
+
 	// Expect file paths as command-line arguments
-	if len(os.Args) < 2 {
-		fmt.Println("Usage: csvsql <file1.csv> [file2.xlsx] ...")
+	if flag.NArg() < 1 {
+		flag.Usage()
 		os.Exit(1)
 	}
 
 	// Use configured database (default: in-memory SQLite)
-	db, err := sql.Open("sqlite3", config.Gcfg.DatabasePath)
+	db, err := sql.Open(database.DriverName, config.Gcfg.DatabasePath)
 	if err != nil {
 		log.Fatal("Failed to open database:", err)
 	}
-	defer db.Close()
+	// Keep a single connection so that in-memory data and attached databases
+	// are visible to every statement
+	db.SetMaxOpenConns(1)
 
 	// Initialize components with dependency injection
 	mapper := mapping.NewMapper()
 	dbManager := database.NewManager(db, mapper)
-	processor := importer.NewProcessor(dbManager)
-	commands := repl.NewCommands(dbManager)
-	formatter := repl.NewFormatter()
+	dbManager.SetNullTokens(config.Gcfg.NullTokens)
+	if err := dbManager.SetChineseCollation(config.Gcfg.Collation); err != nil {
+		log.Fatal(err)
+	}
+	// Restore header mappings kept in a persistent database
+	if err := dbManager.RestoreMappings(); err != nil {
+		log.Fatal("Failed to read saved header mappings:", err)
+	}
+	if err := dbManager.RestoreDefinitions(context.Background()); err != nil {
+		log.Fatal("Failed to restore saved functions and macros:", err)
+	}
+	processor := importer.NewProcessor(dbManager, config.Gcfg)
+	// The manager closes the database, which .open may have replaced; then
+	// downloaded databases that were attached can be removed
+	defer func() {
+		dbManager.Close()
+		processor.Close()
+	}()
+	commands := repl.NewCommands(dbManager, processor)
+	commands.SetTimeout(config.Gcfg.QueryTimeout)
+	formatter := repl.NewFormatter(config.Gcfg.NullDisplay, config.Gcfg.NullExport)
+	// Page through long results only when a user is at the terminal
+	if utils.IsTerminal(os.Stdin) && utils.IsTerminal(os.Stdout) {
+		formatter.SetPageSize(config.Gcfg.PageSize)
+	}
 	session := repl.NewSession(commands, formatter)
 
-	// Load all files provided as arguments
-	for _, filePath := range os.Args[1:] {
-		if err := processor.LoadFile(filePath); err != nil {
-			log.Printf("Warning: Failed to load file %s: %v", filePath, err)
+	// Load all files provided as arguments, showing progress on a terminal
+	if utils.IsTerminal(os.Stdout) {
+		processor.ShowProgress(os.Stdout)
+	}
+	results := processor.LoadFiles(flag.Args())
+	for _, result := range results {
+		if result.Err != nil {
+			log.Printf("Warning: Failed to load file %s: %v", result.Path, result.Err)
 		}
 	}
+	importer.PrintSummary(os.Stdout, results)
+
+	// Poll source files in the background and announce reloads in the REPL
+	if config.Gcfg.Watch {
+		stop := make(chan struct{})
+		defer close(stop)
+		go processor.Watch(config.Gcfg.WatchEvery, stop, session.Notify)
+	}
 
 	// Start the interactive Read-Eval-Print Loop (REPL)
 	session.Run()
 }
+
+// setImportPolicy returns a flag handler selecting an import policy
+func setImportPolicy(policy string) func(string) error {
+	return func(string) error {
+		config.Gcfg.ImportPolicy = policy
+		return nil
+	}
+}
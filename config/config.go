@@ -3,6 +3,15 @@ package config
 import (
 	"os"
 	"strconv"
+	"strings"
+	"time"
+)
+
+// Import policies for tables that already exist when their source is loaded
+const (
+	PolicyReplace = "replace" // drop the table and import the file again
+	PolicyAppend  = "append"  // insert the rows of the file into the table
+	PolicyFail    = "fail"    // refuse to load the file
 )
 
 // Config holds application configuration
@@ -10,6 +19,29 @@ type Config struct {
 	DatabasePath string
 	MaxFileSize  int64
 	Verbose      bool
+	Lenient      bool          // tolerate malformed CSV rows and record them in _rejects
+	FixedSpec    string        // column spec (or spec file path) for fixed-width text files
+	LogPattern   string        // preset name or regular expression for .log files
+	XMLPath      string        // path of the repeating element that forms a row in .xml files
+	Watch        bool          // reload tables when their source files change
+	WatchEvery   time.Duration // polling interval in watch mode
+	ImportPolicy string        // what to do when a changed file's table already exists
+	NullTokens   []string      // cell values imported as SQL NULL
+	NullDisplay  string        // how SQL NULL is shown in the terminal
+	NullExport   string        // how SQL NULL is written to exported files
+	Clean        string        // clean spec (or spec file path) of transforms applied on import
+	DetectDates  bool          // convert columns holding only dates to ISO-8601
+	DateFormats  []string      // Go time layouts tried before the built-in date formats
+	TimeZone     string        // IANA time zone of imported times without an offset
+	PageSize     int           // rows per page of query results in a terminal, 0 for no pager
+	QueryTimeout time.Duration // time limit of each statement in the REPL, 0 for none
+	Collation    string        // collation of imported columns with Chinese headers: pinyin or stroke
+}
+
+// ParseList splits a comma-separated option value. Items are kept
+// verbatim, so ",NA" yields the empty string and "NA".
+func ParseList(value string) []string {
+	return strings.Split(value, ",")
 }
 
 func (c *Config) isInMemoryDB() bool {
@@ -24,6 +56,12 @@ func Load() *Config {
 		DatabasePath: ":memory:",        // Default to in-memory database
 		MaxFileSize:  100 * 1024 * 1024, // 100MB default
 		Verbose:      false,
+		Lenient:      false,
+		WatchEvery:   2 * time.Second,
+		ImportPolicy: PolicyReplace,
+		NullDisplay:  "NULL",
+		PageSize:     40,
+		NullExport:   "",
 	}
 
 	// Override with environment variables if set
@@ -41,6 +79,75 @@ func Load() *Config {
 		config.Verbose = true
 	}
 
+	if lenient := os.Getenv("DANA_LENIENT"); lenient == "true" {
+		config.Lenient = true
+	}
+
+	if spec := os.Getenv("DANA_FIXED_SPEC"); spec != "" {
+		config.FixedSpec = spec
+	}
+
+	if pattern := os.Getenv("DANA_LOG_PATTERN"); pattern != "" {
+		config.LogPattern = pattern
+	}
+
+	if xmlPath := os.Getenv("DANA_XML_PATH"); xmlPath != "" {
+		config.XMLPath = xmlPath
+	}
+
+	if watch := os.Getenv("DANA_WATCH"); watch == "true" {
+		config.Watch = true
+	}
+
+	switch policy := os.Getenv("DANA_IMPORT_POLICY"); policy {
+	case PolicyReplace, PolicyAppend, PolicyFail:
+		config.ImportPolicy = policy
+	}
+
+	if clean := os.Getenv("DANA_CLEAN"); clean != "" {
+		config.Clean = clean
+	}
+
+	if detect := os.Getenv("DANA_DETECT_DATES"); detect == "true" {
+		config.DetectDates = true
+	}
+
+	if formats := os.Getenv("DANA_DATE_FORMATS"); formats != "" {
+		config.DateFormats = ParseList(formats)
+	}
+
+	if zone := os.Getenv("DANA_TIMEZONE"); zone != "" {
+		config.TimeZone = zone
+	}
+
+	if pageSize := os.Getenv("DANA_PAGE_SIZE"); pageSize != "" {
+		if size, err := strconv.Atoi(pageSize); err == nil && size >= 0 {
+			config.PageSize = size
+		}
+	}
+
+	if timeout := os.Getenv("DANA_QUERY_TIMEOUT"); timeout != "" {
+		if d, err := time.ParseDuration(timeout); err == nil && d >= 0 {
+			config.QueryTimeout = d
+		}
+	}
+
+	if collation := os.Getenv("DANA_COLLATE"); collation != "" {
+		config.Collation = collation
+	}
+
+	if tokens, ok := os.LookupEnv("DANA_NULL_TOKENS"); ok {
+		config.NullTokens = ParseList(tokens)
+	}
+
+	if display, ok := os.LookupEnv("DANA_NULL_DISPLAY"); ok {
+		config.NullDisplay = display
+	}
+
+	if export, ok := os.LookupEnv("DANA_NULL_EXPORT"); ok {
+		config.NullExport = export
+	}
+
 	return config
 }
 
@@ -0,0 +1,171 @@
+package database
+
+import (
+	"errors"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// aggregateFunctions are the aggregate SQL functions added to every
+// connection, by name. Like SQLite's own, they take an ORDER BY within the
+// call, e.g. string_agg(x ORDER BY y) or mode(x ORDER BY y DESC).
+var aggregateFunctions = map[string]any{
+	"median":     func() *percentile { return &percentile{fixed: 50} },
+	"percentile": func() *percentile { return &percentile{fixed: -1} },
+	"variance":   func() *moments { return &moments{} },
+	"stddev":     func() *standardDeviation { return &standardDeviation{} },
+	"mode":       func() *mode { return &mode{counts: make(map[string]int)} },
+	// string_agg(x, separator) is built into SQLite; this adds string_agg(x)
+	"string_agg": func() *stringAgg { return &stringAgg{} },
+}
+
+// numericValue returns an argument as a number. Imported columns hold text,
+// so text is read as a number too; NULL and text such as n/a are not numbers.
+func numericValue(v any) (float64, bool) {
+	switch v := v.(type) {
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	case string:
+		n, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return n, err == nil && !math.IsNaN(n) && !math.IsInf(n, 0)
+	default:
+		return 0, false
+	}
+}
+
+// percentile implements median(x) and percentile(x, p), with p from 0 to
+// 100 as in SQLite's percentile extension. Values between two rows are
+// interpolated linearly.
+type percentile struct {
+	fixed  float64 // the percentile of median, -1 when given as p
+	p      float64
+	values []float64
+}
+
+func (a *percentile) Step(v any, p ...any) error {
+	if a.fixed >= 0 && len(p) > 0 {
+		return errors.New("median(x) takes one argument, use percentile(x, p) for others")
+	}
+	if a.fixed < 0 && a.values == nil {
+		if len(p) != 1 {
+			return errors.New("percentile(x, p) takes the percentile p as its second argument")
+		}
+		n, ok := numericValue(p[0])
+		if !ok || n < 0 || n > 100 {
+			return errors.New("percentile(x, p) needs p between 0 and 100")
+		}
+		a.p = n
+	}
+	if n, ok := numericValue(v); ok {
+		a.values = append(a.values, n)
+	}
+	return nil
+}
+
+func (a *percentile) Done() any {
+	if len(a.values) == 0 {
+		return nil
+	}
+	p := a.p
+	if a.fixed >= 0 {
+		p = a.fixed
+	}
+	slices.Sort(a.values)
+	rank := p / 100 * float64(len(a.values)-1)
+	lower := int(math.Floor(rank))
+	upper := min(lower+1, len(a.values)-1)
+	return a.values[lower] + (a.values[upper]-a.values[lower])*(rank-float64(lower))
+}
+
+// moments implements variance(x), the sample variance, with Welford's
+// method so that large values do not lose precision
+type moments struct {
+	n    int
+	mean float64
+	m2   float64
+}
+
+func (a *moments) Step(v any) {
+	x, ok := numericValue(v)
+	if !ok {
+		return
+	}
+	a.n++
+	delta := x - a.mean
+	a.mean += delta / float64(a.n)
+	a.m2 += delta * (x - a.mean)
+}
+
+func (a *moments) Done() any {
+	if a.n < 2 {
+		return nil
+	}
+	return a.m2 / float64(a.n-1)
+}
+
+// standardDeviation implements stddev(x), the sample standard deviation
+type standardDeviation struct {
+	moments
+}
+
+func (a *standardDeviation) Done() any {
+	variance := a.moments.Done()
+	if variance == nil {
+		return nil
+	}
+	return math.Sqrt(variance.(float64))
+}
+
+// mode implements mode(x), the most frequent value. Of values seen equally
+// often, the one seen first wins, so ties follow an ORDER BY in the call.
+type mode struct {
+	counts map[string]int
+	values []any // each distinct value, in the order first seen
+	keys   []string
+}
+
+func (a *mode) Step(v any) {
+	if b, ok := v.([]byte); ok && b == nil {
+		return
+	}
+	// 1 and '1' count as the same value
+	key := FormatValue(v, "")
+	if a.counts[key] == 0 {
+		a.values = append(a.values, v)
+		a.keys = append(a.keys, key)
+	}
+	a.counts[key]++
+}
+
+func (a *mode) Done() any {
+	var best any
+	most := 0
+	for i, key := range a.keys {
+		if a.counts[key] > most {
+			best, most = a.values[i], a.counts[key]
+		}
+	}
+	return best
+}
+
+// stringAgg implements string_agg(x), joining the values with commas
+type stringAgg struct {
+	values []string
+}
+
+func (a *stringAgg) Step(v any) {
+	if s, ok := textValue(v); ok {
+		a.values = append(a.values, s)
+	}
+}
+
+func (a *stringAgg) Done() any {
+	if a.values == nil {
+		return nil
+	}
+	return strings.Join(a.values, ",")
+}
@@ -0,0 +1,50 @@
+package database
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestAggregates(t *testing.T) {
+	m := newTestManager(t)
+	ctx := context.Background()
+	if _, err := m.ExecuteQuery(ctx, `CREATE TABLE n(v, g);
+		INSERT INTO n VALUES ('1', 'a'), ('2', 'b'), ('3', 'b'), ('4', 'a'), ('n/a', 'c'), (NULL, 'c');`); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		query string
+		want  any
+	}{
+		{"SELECT median(v) FROM n;", 2.5},
+		{"SELECT percentile(v, 25) FROM n;", 1.75},
+		{"SELECT percentile(v, 100) FROM n;", 4.0},
+		{"SELECT variance(v) FROM n;", 5.0 / 3},
+		{"SELECT stddev(v) FROM n WHERE v IN ('1', '3');", 1.4142135623730951},
+		{"SELECT stddev(v) FROM n WHERE v = '1';", nil},
+		{"SELECT mode(g) FROM n;", "a"},
+		{"SELECT mode(g ORDER BY g DESC) FROM n;", "c"},
+		{"SELECT mode(g) FROM n WHERE v IN ('2', '3', '4');", "b"},
+		{"SELECT string_agg(g) FROM n WHERE g != 'c';", "a,b,b,a"},
+		{"SELECT string_agg(DISTINCT g ORDER BY g DESC) FROM n;", "c,b,a"},
+		{"SELECT median(v) FROM n WHERE g = 'c';", nil},
+	}
+	for _, tt := range tests {
+		result, err := m.ExecuteQuery(ctx, tt.query)
+		if err != nil {
+			t.Errorf("%s: %v", tt.query, err)
+			continue
+		}
+		if got := result.Rows[0][0]; !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s = %#v, want %#v", tt.query, got, tt.want)
+		}
+	}
+
+	for _, query := range []string{"SELECT percentile(v) FROM n;", "SELECT percentile(v, 101) FROM n;", "SELECT median(v, 50) FROM n;"} {
+		if _, err := m.ExecuteQuery(ctx, query); err == nil {
+			t.Errorf("%s should fail", query)
+		}
+	}
+}
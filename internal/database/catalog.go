@@ -0,0 +1,178 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Bookkeeping tables kept next to the imported data, so that a persistent
+// database remembers header mappings and where its tables came from
+const (
+	MappingsTable = "_csvsql_mappings"
+	SourcesTable  = "_csvsql_sources"
+	// DefinitionsTable keeps the functions and macros defined in the REPL
+	DefinitionsTable = "_csvsql_definitions"
+	// CatalogPrefix starts the name of every bookkeeping table
+	CatalogPrefix = "_csvsql_"
+)
+
+// execer is implemented by both *sql.DB and *sql.Tx
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+// SourceRecord describes a file that tables were imported from
+type SourceRecord struct {
+	Path    string
+	Tables  []string
+	Size    int64
+	ModTime time.Time
+	Hash    string
+}
+
+// ensureCatalog creates the bookkeeping tables if they do not exist yet
+func ensureCatalog(e execer) error {
+	_, err := e.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (table_name TEXT, header TEXT, column_name TEXT);
+CREATE TABLE IF NOT EXISTS %s (path TEXT, table_name TEXT, size INTEGER, mod_time TEXT, hash TEXT, loaded_at TEXT);
+CREATE TABLE IF NOT EXISTS %s (kind TEXT, name TEXT, params TEXT, body TEXT);`,
+		MappingsTable, SourcesTable, DefinitionsTable))
+	return err
+}
+
+// RestoreMappings loads the header mappings saved in the database into the
+// mapper, so that tables of a persistent database keep their Chinese headers
+func (m *Manager) RestoreMappings() error {
+	mappings, err := readMappings(m.db.Load(), "main")
+	if err != nil {
+		return err
+	}
+	for tableName, tableMappings := range mappings {
+		for header, columnName := range tableMappings {
+			m.mapper.AddMapping(tableName, header, columnName)
+		}
+	}
+	return nil
+}
+
+// restoreAttachedMappings loads the header mappings saved in an attached
+// database, naming its tables schema.table. Databases not written by csvsql
+// have none.
+func (m *Manager) restoreAttachedMappings(schema string) error {
+	mappings, err := readMappings(m.db.Load(), schema)
+	if err != nil {
+		return err
+	}
+	for tableName, tableMappings := range mappings {
+		m.mapper.SetTableMappings(schema+"."+tableName, tableMappings)
+	}
+	return nil
+}
+
+// hasTable reports whether a schema of db has a table. Bookkeeping tables
+// are read only if they exist, so that reading a database written by
+// another program leaves it unchanged.
+func hasTable(db *sql.DB, schema, tableName string) (bool, error) {
+	var n int
+	query := fmt.Sprintf("SELECT count(*) FROM %s.sqlite_master WHERE type='table' AND name=?;", schema)
+	err := db.QueryRow(query, tableName).Scan(&n)
+	return n > 0, err
+}
+
+// readMappings reads the header mappings saved in a schema of db
+func readMappings(db *sql.DB, schema string) (map[string]map[string]string, error) {
+	mappings := make(map[string]map[string]string)
+	if ok, err := hasTable(db, schema, MappingsTable); err != nil || !ok {
+		return mappings, err
+	}
+
+	rows, err := db.Query(fmt.Sprintf("SELECT table_name, header, column_name FROM %s.%s;", schema, MappingsTable))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var tableName, header, columnName string
+		if err := rows.Scan(&tableName, &header, &columnName); err != nil {
+			return nil, err
+		}
+		if mappings[tableName] == nil {
+			mappings[tableName] = make(map[string]string)
+		}
+		mappings[tableName][header] = columnName
+	}
+	return mappings, rows.Err()
+}
+
+// saveMappings stores the current mappings of a table in the database
+func (m *Manager) saveMappings(e execer, tableName string) error {
+	if err := ensureCatalog(e); err != nil {
+		return err
+	}
+	if _, err := e.Exec(fmt.Sprintf("DELETE FROM %s WHERE table_name=?;", MappingsTable), tableName); err != nil {
+		return err
+	}
+	for header, columnName := range m.mapper.GetTableMappings(tableName) {
+		query := fmt.Sprintf("INSERT INTO %s VALUES (?, ?, ?);", MappingsTable)
+		if _, err := e.Exec(query, tableName, header, columnName); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RecordSource remembers which tables were imported from a file and the
+// state of the file at that time
+func (m *Manager) RecordSource(src SourceRecord) error {
+	if err := ensureCatalog(m.db.Load()); err != nil {
+		return err
+	}
+
+	tx, err := m.begin(context.Background())
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE path=?;", SourcesTable), src.Path); err != nil {
+		tx.Rollback()
+		return err
+	}
+	loadedAt := time.Now().Format(time.RFC3339)
+	for _, tableName := range src.Tables {
+		query := fmt.Sprintf("INSERT INTO %s VALUES (?, ?, ?, ?, ?, ?);", SourcesTable)
+		_, err := tx.Exec(query, src.Path, tableName, src.Size, src.ModTime.Format(time.RFC3339Nano), src.Hash, loadedAt)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// LookupSource returns the recorded state of a source file, if any
+func (m *Manager) LookupSource(path string) (SourceRecord, bool, error) {
+	if ok, err := hasTable(m.db.Load(), "main", SourcesTable); err != nil || !ok {
+		return SourceRecord{}, false, err
+	}
+
+	rows, err := m.db.Load().Query(fmt.Sprintf("SELECT table_name, size, mod_time, hash FROM %s WHERE path=?;", SourcesTable), path)
+	if err != nil {
+		return SourceRecord{}, false, err
+	}
+	defer rows.Close()
+
+	src := SourceRecord{Path: path}
+	for rows.Next() {
+		var tableName, modTime string
+		if err := rows.Scan(&tableName, &src.Size, &modTime, &src.Hash); err != nil {
+			return SourceRecord{}, false, err
+		}
+		src.ModTime, _ = time.Parse(time.RFC3339Nano, modTime)
+		src.Tables = append(src.Tables, tableName)
+	}
+	if err := rows.Err(); err != nil {
+		return SourceRecord{}, false, err
+	}
+	return src, len(src.Tables) > 0, nil
+}
@@ -0,0 +1,484 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+
+	sqlite3 "github.com/mattn/go-sqlite3"
+
+	"csvsql/pkg/utils"
+)
+
+// Kinds of definitions kept in DefinitionsTable
+const (
+	functionKind = "function"
+	macroKind    = "macro"
+)
+
+// maxMacroDepth bounds macros expanding to other macros, so that a macro
+// using itself fails instead of expanding forever
+const maxMacroDepth = 10
+
+// Definition is a SQL function or macro defined in the REPL, written as
+// name(param, ...) AS body. It is kept in the workspace with the tables.
+type Definition struct {
+	Name   string
+	Params []string
+	Body   string
+}
+
+// String writes the definition as it is entered
+func (d Definition) String() string {
+	return fmt.Sprintf("%s(%s) AS %s", d.Name, strings.Join(d.Params, ", "), d.Body)
+}
+
+// ParseDefinition reads a definition such as fiscal_q(d) AS (strftime('%m', d) + 2) / 3
+func ParseDefinition(text string) (Definition, error) {
+	usage := fmt.Errorf("invalid definition %q, expected name(param, ...) AS body", text)
+	open := strings.IndexByte(text, '(')
+	end := strings.IndexByte(text, ')')
+	if open < 0 || end < open {
+		return Definition{}, usage
+	}
+	def := Definition{Name: strings.TrimSpace(text[:open])}
+	rest := strings.TrimSpace(text[end+1:])
+	if len(rest) < 3 || !strings.EqualFold(rest[:2], "AS") || (rest[2] != ' ' && rest[2] != '\t') {
+		return Definition{}, usage
+	}
+	def.Body = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(rest[2:]), ";"))
+	if def.Body == "" {
+		return Definition{}, usage
+	}
+
+	if !isIdentifier(def.Name) {
+		return Definition{}, fmt.Errorf("invalid name %q, use letters, digits and underscores", def.Name)
+	}
+	if params := strings.TrimSpace(text[open+1 : end]); params != "" {
+		for _, param := range strings.Split(params, ",") {
+			param = strings.TrimSpace(param)
+			if !isIdentifier(param) {
+				return Definition{}, fmt.Errorf("invalid parameter name %q, use letters, digits and underscores", param)
+			}
+			if slices.Contains(def.Params, param) {
+				return Definition{}, fmt.Errorf("parameter %s is listed twice", param)
+			}
+			def.Params = append(def.Params, param)
+		}
+	}
+	return def, nil
+}
+
+// isIdentifier reports whether name can be used unquoted in SQL
+func isIdentifier(name string) bool {
+	return name != "" && utils.SanitizeTableName(name) == name
+}
+
+// userFunction evaluates the body of a function defined in the REPL. The
+// body runs on the connection calling the function, so it may read tables.
+type userFunction struct {
+	Definition
+	stmt driver.Stmt // prepared on first call
+	busy bool        // set while the body runs, to refuse recursion
+}
+
+// query selects the body with the arguments bound to columns named after
+// the parameters, so the body refers to them like to columns
+func (f *userFunction) query() string {
+	if len(f.Params) == 0 {
+		return fmt.Sprintf("SELECT %s;", f.Body)
+	}
+	columns := make([]string, len(f.Params))
+	for i, param := range f.Params {
+		columns[i] = "? AS " + param
+	}
+	return fmt.Sprintf("SELECT %s FROM (SELECT %s);", f.Body, strings.Join(columns, ", "))
+}
+
+// call is registered on the connection as the SQL function
+func (f *userFunction) call(conn *sqlite3.SQLiteConn, args ...any) (any, error) {
+	if len(args) != len(f.Params) {
+		return nil, fmt.Errorf("wrong number of arguments to function %s(), expected %d", f.Name, len(f.Params))
+	}
+	if f.busy {
+		return nil, fmt.Errorf("%s() cannot call itself", f.Name)
+	}
+	f.busy = true
+	defer func() { f.busy = false }()
+
+	if f.stmt == nil {
+		stmt, err := conn.Prepare(f.query())
+		if err != nil {
+			return nil, fmt.Errorf("%s(): %w", f.Name, err)
+		}
+		f.stmt = stmt
+	}
+	values := make([]driver.NamedValue, len(args))
+	for i, arg := range args {
+		values[i].Ordinal = i + 1
+		// NULL arrives as a nil []byte
+		if b, ok := arg.([]byte); !ok || b != nil {
+			values[i].Value = arg
+		}
+	}
+	rows, err := f.stmt.(driver.StmtQueryContext).QueryContext(context.Background(), values)
+	if err != nil {
+		return nil, fmt.Errorf("%s(): %w", f.Name, err)
+	}
+	defer rows.Close()
+	dest := make([]driver.Value, 1)
+	if err := rows.Next(dest); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("%s(): %w", f.Name, err)
+	}
+	return dest[0], nil
+}
+
+// close finalizes the prepared body
+func (f *userFunction) close() {
+	if f.stmt != nil {
+		f.stmt.Close()
+		f.stmt = nil
+	}
+}
+
+// DefineFunction adds a scalar SQL function whose body is a SQL expression
+// over its parameters, replacing an earlier definition of the same name,
+// and saves it in the workspace
+func (m *Manager) DefineFunction(ctx context.Context, def Definition) error {
+	if key := strings.ToLower(def.Name); !m.registered[key] {
+		var n int
+		if err := m.db.Load().QueryRowContext(ctx, "SELECT count(*) FROM pragma_function_list WHERE name = ?;", key).Scan(&n); err != nil {
+			return err
+		}
+		if n > 0 {
+			return fmt.Errorf("%s is a built-in function", def.Name)
+		}
+	}
+
+	// Check the body now rather than on first use
+	f := &userFunction{Definition: def}
+	stmt, err := m.db.Load().PrepareContext(ctx, f.query())
+	if err != nil {
+		return fmt.Errorf("invalid function body: %w", err)
+	}
+	stmt.Close()
+
+	if err := m.saveDefinition(ctx, functionKind, def); err != nil {
+		return err
+	}
+	return m.registerFunction(ctx, f)
+}
+
+// registerFunction registers a user function on the connection, taking
+// the place of an earlier one of the same name
+func (m *Manager) registerFunction(ctx context.Context, f *userFunction) error {
+	if err := register(ctx, m.db.Load(), f); err != nil {
+		return err
+	}
+	key := strings.ToLower(f.Name)
+	if previous, ok := m.functions[key]; ok {
+		previous.close()
+	}
+	m.functions[key] = f
+	m.registered[key] = true
+	return nil
+}
+
+// register adds a user function to the connection of db
+func register(ctx context.Context, db *sql.DB, f *userFunction) error {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return conn.Raw(func(driverConn any) error {
+		sqliteConn, ok := driverConn.(*sqlite3.SQLiteConn)
+		if !ok {
+			return errors.New("functions need a SQLite connection")
+		}
+		call := func(args ...any) (any, error) { return f.call(sqliteConn, args...) }
+		if err := sqliteConn.RegisterFunc(f.Name, call, false); err != nil {
+			return fmt.Errorf("register function %s: %w", f.Name, err)
+		}
+		return nil
+	})
+}
+
+// DropFunction removes a function defined with DefineFunction. SQLite
+// cannot unregister it, so the function is left failing as if undefined.
+func (m *Manager) DropFunction(ctx context.Context, name string) error {
+	key := strings.ToLower(name)
+	f, ok := m.functions[key]
+	if !ok {
+		return fmt.Errorf("no such function: %s", name)
+	}
+	if err := m.deleteDefinition(ctx, functionKind, f.Name); err != nil {
+		return err
+	}
+
+	conn, err := m.db.Load().Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.Raw(func(driverConn any) error {
+		sqliteConn, ok := driverConn.(*sqlite3.SQLiteConn)
+		if !ok {
+			return errors.New("functions need a SQLite connection")
+		}
+		undefined := func(args ...any) (any, error) { return nil, fmt.Errorf("no such function: %s", f.Name) }
+		return sqliteConn.RegisterFunc(f.Name, undefined, false)
+	})
+	f.close()
+	delete(m.functions, key)
+	return err
+}
+
+// Functions returns the functions defined with DefineFunction by name
+func (m *Manager) Functions() []Definition {
+	defs := make([]Definition, 0, len(m.functions))
+	for _, f := range m.functions {
+		defs = append(defs, f.Definition)
+	}
+	slices.SortFunc(defs, func(a, b Definition) int { return strings.Compare(a.Name, b.Name) })
+	return defs
+}
+
+// DefineMacro adds a macro, replacing an earlier one of the same name, and
+// saves it in the workspace. Its body is SQL text in which {param} stands
+// for an argument; ExpandMacros replaces @name(arg, ...) with it.
+func (m *Manager) DefineMacro(ctx context.Context, def Definition) error {
+	if err := m.saveDefinition(ctx, macroKind, def); err != nil {
+		return err
+	}
+	m.macros[strings.ToLower(def.Name)] = def
+	return nil
+}
+
+// DropMacro removes a macro defined with DefineMacro
+func (m *Manager) DropMacro(ctx context.Context, name string) error {
+	key := strings.ToLower(name)
+	def, ok := m.macros[key]
+	if !ok {
+		return fmt.Errorf("no such macro: %s", name)
+	}
+	if err := m.deleteDefinition(ctx, macroKind, def.Name); err != nil {
+		return err
+	}
+	delete(m.macros, key)
+	return nil
+}
+
+// Macros returns the macros defined with DefineMacro by name
+func (m *Manager) Macros() []Definition {
+	defs := slices.Collect(maps.Values(m.macros))
+	slices.SortFunc(defs, func(a, b Definition) int { return strings.Compare(a.Name, b.Name) })
+	return defs
+}
+
+// ExpandMacros replaces each @name(arg, ...) of a defined macro, or @name
+// for a macro without parameters, with the macro's body, the arguments
+// taking the place of its {param} placeholders as written. Macros may use
+// other macros. Text in string literals, quoted identifiers and comments
+// is kept, as is @name when no macro has that name, such as a parameter.
+func (m *Manager) ExpandMacros(script string) (string, error) {
+	if len(m.macros) == 0 {
+		return script, nil
+	}
+	return m.expandMacros(script, 0)
+}
+
+func (m *Manager) expandMacros(script string, depth int) (string, error) {
+	var b strings.Builder
+	expanded := false
+	for i := 0; i < len(script); {
+		if end, ok := skipLiteral(script, i); ok {
+			b.WriteString(script[i:end])
+			i = end
+			continue
+		}
+		c := script[i]
+		switch {
+		case c == '@':
+			end := i + 1
+			for end < len(script) && isWordByte(script[end]) {
+				end++
+			}
+			def, ok := m.macros[strings.ToLower(script[i+1:end])]
+			if !ok {
+				b.WriteString(script[i:end])
+				i = end
+				continue
+			}
+			args, next, err := macroArguments(script, end)
+			if err != nil {
+				return "", fmt.Errorf("@%s: %w", def.Name, err)
+			}
+			if len(args) != len(def.Params) {
+				return "", fmt.Errorf("wrong number of arguments to macro @%s, expected %d", def.Name, len(def.Params))
+			}
+			b.WriteString(substituteParams(def, args))
+			i, expanded = next, true
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+
+	if !expanded {
+		return b.String(), nil
+	}
+	if depth == maxMacroDepth {
+		return "", errors.New("macros nested too deeply, does a macro use itself?")
+	}
+	return m.expandMacros(b.String(), depth+1)
+}
+
+// macroArguments reads the parenthesised arguments following a macro name
+// at i, split at the commas outside quotes and nested parentheses. A macro
+// name without parentheses has no arguments. It returns the position after
+// the arguments.
+func macroArguments(script string, i int) ([]string, int, error) {
+	if i >= len(script) || script[i] != '(' {
+		return nil, i, nil
+	}
+	var args []string
+	start, depth := i+1, 0
+	for j := i + 1; j < len(script); {
+		switch script[j] {
+		case '\'', '"', '`', '[':
+			end, ok := skipQuoted(script, j)
+			if !ok {
+				return nil, 0, errors.New("unterminated quote in the arguments")
+			}
+			j = end
+			continue
+		case '(':
+			depth++
+		case ')':
+			if depth > 0 {
+				depth--
+				break
+			}
+			if arg := strings.TrimSpace(script[start:j]); arg != "" || len(args) > 0 {
+				args = append(args, arg)
+			}
+			return args, j + 1, nil
+		case ',':
+			if depth == 0 {
+				args = append(args, strings.TrimSpace(script[start:j]))
+				start = j + 1
+			}
+		}
+		j++
+	}
+	return nil, 0, errors.New("missing ) after the arguments")
+}
+
+// substituteParams writes the body of a macro with its arguments in place
+func substituteParams(def Definition, args []string) string {
+	if len(def.Params) == 0 {
+		return def.Body
+	}
+	pairs := make([]string, 0, 2*len(args))
+	for i, param := range def.Params {
+		pairs = append(pairs, "{"+param+"}", args[i])
+	}
+	return strings.NewReplacer(pairs...).Replace(def.Body)
+}
+
+// saveDefinition stores a definition in the workspace
+func (m *Manager) saveDefinition(ctx context.Context, kind string, def Definition) error {
+	if err := ensureCatalog(m.db.Load()); err != nil {
+		return err
+	}
+	if err := m.deleteDefinition(ctx, kind, def.Name); err != nil {
+		return err
+	}
+	query := fmt.Sprintf("INSERT INTO %s VALUES (?, ?, ?, ?);", DefinitionsTable)
+	_, err := m.db.Load().ExecContext(ctx, query, kind, def.Name, strings.Join(def.Params, ","), def.Body)
+	return err
+}
+
+// deleteDefinition removes a definition from the workspace
+func (m *Manager) deleteDefinition(ctx context.Context, kind, name string) error {
+	query := fmt.Sprintf("DELETE FROM %s WHERE kind = ? AND lower(name) = lower(?);", DefinitionsTable)
+	_, err := m.db.Load().ExecContext(ctx, query, kind, name)
+	return err
+}
+
+// RestoreDefinitions loads the functions and macros saved in the database,
+// replacing those defined before
+func (m *Manager) RestoreDefinitions(ctx context.Context) error {
+	db := m.db.Load()
+	functions, macros, err := readDefinitions(ctx, db)
+	if err != nil {
+		return err
+	}
+	for _, f := range functions {
+		if err := register(ctx, db, f); err != nil {
+			return err
+		}
+	}
+	m.setDefinitions(functions, macros)
+	return nil
+}
+
+// readDefinitions reads the functions and macros saved in db
+func readDefinitions(ctx context.Context, db *sql.DB) ([]*userFunction, map[string]Definition, error) {
+	macros := make(map[string]Definition)
+	if ok, err := hasTable(db, "main", DefinitionsTable); err != nil || !ok {
+		return nil, macros, err
+	}
+
+	rows, err := db.QueryContext(ctx, fmt.Sprintf("SELECT kind, name, params, body FROM %s;", DefinitionsTable))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var functions []*userFunction
+	for rows.Next() {
+		var kind, params string
+		var def Definition
+		if err := rows.Scan(&kind, &def.Name, &params, &def.Body); err != nil {
+			return nil, nil, err
+		}
+		if params != "" {
+			def.Params = strings.Split(params, ",")
+		}
+		switch kind {
+		case functionKind:
+			functions = append(functions, &userFunction{Definition: def})
+		case macroKind:
+			macros[strings.ToLower(def.Name)] = def
+		}
+	}
+	return functions, macros, rows.Err()
+}
+
+// setDefinitions replaces the functions and macros defined before with
+// those read from a database; the functions are registered already
+func (m *Manager) setDefinitions(functions []*userFunction, macros map[string]Definition) {
+	for _, f := range m.functions {
+		f.close()
+	}
+	clear(m.functions)
+	clear(m.registered)
+	for _, f := range functions {
+		key := strings.ToLower(f.Name)
+		m.functions[key] = f
+		m.registered[key] = true
+	}
+	m.macros = macros
+}
@@ -0,0 +1,149 @@
+package database
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseDefinition(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Definition
+		wantErr bool
+	}{
+		{in: "fiscal_q(d) AS (strftime('%m', d) + 2) / 3;", want: Definition{"fiscal_q", []string{"d"}, "(strftime('%m', d) + 2) / 3"}},
+		{in: "top(n, col) as SELECT * FROM t ORDER BY {col} LIMIT {n}", want: Definition{"top", []string{"n", "col"}, "SELECT * FROM t ORDER BY {col} LIMIT {n}"}},
+		{in: "today() AS date('now')", want: Definition{Name: "today", Body: "date('now')"}},
+		{in: "today AS date('now')", wantErr: true},
+		{in: "f(x) date('now')", wantErr: true},
+		{in: "f(x) AS", wantErr: true},
+		{in: "季度(d) AS d", wantErr: true},
+		{in: "f(x, x) AS x", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseDefinition(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseDefinition() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseDefinition() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDefineFunction(t *testing.T) {
+	ctx := context.Background()
+	m := newTestManager(t)
+	if _, err := m.ExecuteQuery(ctx, "CREATE TABLE codes(code, label); INSERT INTO codes VALUES (1, '有效'), (2, '注销');"); err != nil {
+		t.Fatal(err)
+	}
+	for _, text := range []string{
+		"fiscal_q(d) AS (CAST(strftime('%m', d) AS INTEGER) + 2) / 3",
+		"status(c) AS (SELECT label FROM codes WHERE code = c)",
+		"label(c) AS coalesce(status(c), '未知')",
+	} {
+		def, err := ParseDefinition(text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := m.DefineFunction(ctx, def); err != nil {
+			t.Fatalf("DefineFunction(%s) error = %v", text, err)
+		}
+	}
+
+	query := "SELECT fiscal_q('2024-05-02'), fiscal_q(NULL), status(2), label(9);"
+	want := []any{int64(2), nil, "注销", "未知"}
+	result, err := m.ExecuteQuery(ctx, query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(result.Rows[0], want) {
+		t.Errorf("functions = %#v, want %#v", result.Rows[0], want)
+	}
+
+	for _, text := range []string{"upper(s) AS s", "bad(x) AS y + 1"} {
+		def, _ := ParseDefinition(text)
+		if err := m.DefineFunction(ctx, def); err == nil {
+			t.Errorf("DefineFunction(%s) should fail", text)
+		}
+	}
+	if _, err := m.ExecuteQuery(ctx, "SELECT fiscal_q(1, 2);"); err == nil {
+		t.Error("calling fiscal_q() with two arguments should fail")
+	}
+
+	// Functions are saved with the workspace
+	saved := filepath.Join(t.TempDir(), "work.db")
+	if err := m.Save(ctx, saved); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.DropFunction(ctx, "status"); err != nil {
+		t.Fatalf("DropFunction() error = %v", err)
+	}
+	if _, err := m.ExecuteQuery(ctx, "SELECT status(1);"); err == nil {
+		t.Error("a dropped function should fail")
+	}
+	other := newTestManager(t)
+	if err := other.Open(saved); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(other.Functions()); got != 3 {
+		t.Errorf("Functions() after Open() = %d, want 3", got)
+	}
+	result, err = other.ExecuteQuery(ctx, query)
+	if err != nil {
+		t.Fatalf("functions after Open(): %v", err)
+	}
+	if !reflect.DeepEqual(result.Rows[0], want) {
+		t.Errorf("functions after Open() = %#v, want %#v", result.Rows[0], want)
+	}
+}
+
+func TestExpandMacros(t *testing.T) {
+	ctx := context.Background()
+	m := newTestManager(t)
+	for _, text := range []string{
+		"top(n, col) AS SELECT * FROM sales ORDER BY {col} DESC LIMIT {n}",
+		"recent() AS 日期 >= date('now', '-30 days')",
+		"recent_top(n) AS @top({n}, 金额)",
+		"loop() AS @loop",
+	} {
+		def, err := ParseDefinition(text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := m.DefineMacro(ctx, def); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{in: "@top(10, amount);", want: "SELECT * FROM sales ORDER BY amount DESC LIMIT 10;"},
+		{in: "@TOP(3, max(a, b))", want: "SELECT * FROM sales ORDER BY max(a, b) DESC LIMIT 3"},
+		{in: "@top(1, 'a,b')", want: "SELECT * FROM sales ORDER BY 'a,b' DESC LIMIT 1"},
+		{in: "SELECT * FROM t WHERE @recent AND x = @x", want: "SELECT * FROM t WHERE 日期 >= date('now', '-30 days') AND x = @x"},
+		{in: "SELECT '@recent' -- @recent\n, @recent()", want: "SELECT '@recent' -- @recent\n, 日期 >= date('now', '-30 days')"},
+		{in: "@recent_top(5)", want: "SELECT * FROM sales ORDER BY 金额 DESC LIMIT 5"},
+		{in: "@top(10)", wantErr: true},
+		{in: "@top(10, amount", wantErr: true},
+		{in: "@loop", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := m.ExpandMacros(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ExpandMacros() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ExpandMacros() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
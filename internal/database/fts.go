@@ -0,0 +1,408 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"csvsql/internal/zh"
+)
+
+// searchIndexPrefix starts the name of the full-text index of a table,
+// followed by the table name
+const searchIndexPrefix = CatalogPrefix + "fts_"
+
+// snippetLength is the number of characters shown around the first match
+// in a snippet
+const snippetLength = 40
+
+// Marks around the matches in a snippet
+const (
+	highlightStart = "【"
+	highlightEnd   = "】"
+)
+
+// errNoFTS5 is returned when SQLite was built without FTS5
+var errNoFTS5 = errors.New("full-text search needs csvsql built with -tags sqlite_fts5")
+
+// SearchIndex describes the full-text index of a table
+type SearchIndex struct {
+	Table   string
+	Columns []string
+}
+
+// searchIndexName returns the name of the index of a table
+func searchIndexName(tableName string) string {
+	return searchIndexPrefix + tableName
+}
+
+// CreateSearchIndex builds the full-text index of a table over the given
+// columns, or all columns, replacing an earlier index, and returns the
+// number of rows indexed. Columns may be named by their Chinese headers.
+// The index is an FTS5 table of the terms of zh.Tokens, which splits
+// Chinese text into pairs of characters; it is not updated when the table
+// changes and is dropped when the table is re-imported. FTS5 is only part
+// of csvsql built with -tags sqlite_fts5.
+func (m *Manager) CreateSearchIndex(ctx context.Context, tableName string, columns []string) (int64, error) {
+	existing, err := m.tableColumnList(tableName)
+	if err != nil {
+		return 0, err
+	}
+	if len(columns) == 0 {
+		columns = existing
+	}
+	columns = slices.Clone(columns)
+	for i, column := range columns {
+		if name, ok := m.columnForHeader(tableName, column); ok {
+			columns[i] = name
+		}
+		if !slices.Contains(existing, columns[i]) {
+			return 0, fmt.Errorf("no such column in %s: %s", tableName, column)
+		}
+	}
+
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	index := searchIndexName(tableName)
+	tokens := make([]string, len(columns))
+	for i, column := range columns {
+		tokens[i] = fmt.Sprintf("fts_tokens(%s)", column)
+	}
+	statements := []string{
+		fmt.Sprintf("DROP TABLE IF EXISTS %s;", index),
+		fmt.Sprintf("CREATE VIRTUAL TABLE %s USING fts5(%s, tokenize='unicode61 remove_diacritics 0');", index, strings.Join(columns, ", ")),
+		fmt.Sprintf("INSERT INTO %s(rowid, %s) SELECT rowid, %s FROM %s;", index, strings.Join(columns, ", "), strings.Join(tokens, ", "), tableName),
+	}
+	var result sql.Result
+	for _, statement := range statements {
+		if result, err = tx.ExecContext(ctx, statement); err != nil {
+			if strings.Contains(err.Error(), "no such module: fts5") {
+				return 0, errNoFTS5
+			}
+			return 0, fmt.Errorf("build full-text index failed: %w", err)
+		}
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return n, tx.Commit()
+}
+
+// DropSearchIndex removes the full-text index of a table
+func (m *Manager) DropSearchIndex(ctx context.Context, tableName string) error {
+	if _, ok, err := m.searchIndex(tableName); err != nil || !ok {
+		if err == nil {
+			err = fmt.Errorf("no full-text index on %s", tableName)
+		}
+		return err
+	}
+	_, err := m.db.Load().ExecContext(ctx, fmt.Sprintf("DROP TABLE %s;", searchIndexName(tableName)))
+	return err
+}
+
+// SearchIndexes returns the full-text indexes by table name
+func (m *Manager) SearchIndexes() ([]SearchIndex, error) {
+	query := fmt.Sprintf("SELECT substr(name, %d) FROM sqlite_master WHERE type = 'table' AND substr(name, 1, %d) = '%s' AND sql LIKE 'CREATE VIRTUAL TABLE%%' ORDER BY name;",
+		len(searchIndexPrefix)+1, len(searchIndexPrefix), searchIndexPrefix)
+	rows, err := m.db.Load().Query(query)
+	if err != nil {
+		return nil, err
+	}
+	var tables []string
+	for rows.Next() {
+		var tableName string
+		if err := rows.Scan(&tableName); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		tables = append(tables, tableName)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	indexes := make([]SearchIndex, 0, len(tables))
+	for _, tableName := range tables {
+		index, _, err := m.searchIndex(tableName)
+		if err != nil {
+			return nil, err
+		}
+		indexes = append(indexes, index)
+	}
+	return indexes, nil
+}
+
+// searchIndex describes the index of a table, if it has one
+func (m *Manager) searchIndex(tableName string) (SearchIndex, bool, error) {
+	if ok, err := m.TableExists(searchIndexName(tableName)); err != nil || !ok {
+		return SearchIndex{}, false, err
+	}
+	columns, err := m.tableColumnList(searchIndexName(tableName))
+	if err != nil {
+		return SearchIndex{}, false, err
+	}
+	return SearchIndex{Table: tableName, Columns: columns}, true, nil
+}
+
+// tableColumnList returns the column names of a table in order
+func (m *Manager) tableColumnList(tableName string) ([]string, error) {
+	rows, err := m.db.Load().Query("SELECT name FROM pragma_table_info(?);", tableName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var columns []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		columns = append(columns, name)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("no such table: %s", tableName)
+	}
+	return columns, nil
+}
+
+// ExpandSearches replaces each search(table, 'query') with a subquery
+// selecting the rows of the table matching the query from its full-text
+// index, best first, with two more columns: rank, higher for better
+// matches, and snippet, the text around the first match with the matches
+// marked 【like this】. All words of the query must match; a word of
+// Chinese characters matches them in sequence.
+func (m *Manager) ExpandSearches(script string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(script); {
+		if end, ok := skipLiteral(script, i); ok {
+			b.WriteString(script[i:end])
+			i = end
+			continue
+		}
+		c := script[i]
+		switch {
+		case isWordByte(c):
+			end := i
+			for end < len(script) && isWordByte(script[end]) {
+				end++
+			}
+			tableName, query, next, ok := searchCall(script, i, end)
+			if !ok {
+				b.WriteString(script[i:end])
+				i = end
+				continue
+			}
+			subquery, err := m.searchQuery(tableName, query)
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(subquery)
+			i = next
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	return b.String(), nil
+}
+
+// searchCall reads search(table, 'query') from the word at start..end,
+// returning the position after it
+func searchCall(script string, start, end int) (tableName, query string, next int, ok bool) {
+	if !strings.EqualFold(script[start:end], "search") {
+		return "", "", 0, false
+	}
+	i := skipSpace(script, end)
+	if i >= len(script) || script[i] != '(' {
+		return "", "", 0, false
+	}
+	i = skipSpace(script, i+1)
+	nameStart := i
+	for i < len(script) && isWordByte(script[i]) {
+		i++
+	}
+	tableName = script[nameStart:i]
+	i = skipSpace(script, i)
+	if tableName == "" || i >= len(script) || script[i] != ',' {
+		return "", "", 0, false
+	}
+	i = skipSpace(script, i+1)
+	if i >= len(script) || script[i] != '\'' {
+		return "", "", 0, false
+	}
+	literalEnd, closed := skipQuoted(script, i)
+	if !closed {
+		return "", "", 0, false
+	}
+	query = strings.ReplaceAll(script[i+1:literalEnd-1], "''", "'")
+	i = skipSpace(script, literalEnd)
+	if i >= len(script) || script[i] != ')' {
+		return "", "", 0, false
+	}
+	return tableName, query, i + 1, true
+}
+
+func skipSpace(script string, i int) int {
+	for i < len(script) && strings.IndexByte(" \t\r\n", script[i]) >= 0 {
+		i++
+	}
+	return i
+}
+
+// searchQuery writes the subquery of search(table, 'query')
+func (m *Manager) searchQuery(tableName, query string) (string, error) {
+	index, ok, err := m.searchIndex(tableName)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", fmt.Errorf("no full-text index on %s, create one with .fts %s", tableName, tableName)
+	}
+	match := matchExpression(query)
+	if match == "" {
+		return "", fmt.Errorf("nothing to search for in %q", query)
+	}
+
+	indexName := searchIndexName(tableName)
+	columns := make([]string, len(index.Columns))
+	for i, column := range index.Columns {
+		columns[i] = tableName + "." + column
+	}
+	// The texts are written as blobs so that the translation of Chinese
+	// headers in the query leaves them alone
+	// FTS5 ranks by BM25, lower for better matches. Its own snippet would
+	// show the indexed pairs of characters rather than the text.
+	return fmt.Sprintf("(SELECT %[1]s.*, -bm25(%[2]s) AS rank, fts_snippet(%[3]s, %[4]s) AS snippet FROM %[2]s JOIN %[1]s ON %[1]s.rowid = %[2]s.rowid WHERE %[2]s MATCH %[5]s ORDER BY rank DESC)",
+		tableName, indexName, textLiteral(query), strings.Join(columns, ", "), textLiteral(match)), nil
+}
+
+// textLiteral writes text as a SQL expression that contains no characters
+// of the text
+func textLiteral(s string) string {
+	return fmt.Sprintf("CAST(X'%s' AS TEXT)", hex.EncodeToString([]byte(s)))
+}
+
+// matchExpression turns a search query into an FTS5 query: each word of
+// the query becomes a phrase of its tokens, and a lone Chinese character the
+// prefix of a token. OR between words is kept.
+func matchExpression(query string) string {
+	var terms []string
+	for _, word := range strings.Fields(query) {
+		if word == "OR" && len(terms) > 0 {
+			terms = append(terms, word)
+			continue
+		}
+		tokens := zh.SearchTokens(word)
+		if len(tokens) == 0 {
+			continue
+		}
+		for i, token := range tokens {
+			tokens[i] = `"` + token + `"`
+			if r, size := utf8.DecodeRuneInString(token); size == len(token) && unicode.Is(unicode.Han, r) {
+				tokens[i] += "*"
+			}
+		}
+		terms = append(terms, strings.Join(tokens, " + "))
+	}
+	if len(terms) > 0 && terms[len(terms)-1] == "OR" {
+		terms = terms[:len(terms)-1]
+	}
+	return strings.Join(terms, " ")
+}
+
+// ftsTokens implements fts_tokens(text), the text as indexed
+func ftsTokens(s string) any {
+	return strings.Join(zh.Tokens(s), " ")
+}
+
+// ftsSnippet implements fts_snippet(query, text, ...): about snippetLength
+// characters of the first text containing a word of the query, around the
+// first match, with every match marked
+func ftsSnippet(query any, texts ...any) any {
+	q, ok := textValue(query)
+	if !ok {
+		return nil
+	}
+	var words [][]rune
+	for _, word := range strings.FieldsFunc(zh.Fold(q), func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) }) {
+		words = append(words, []rune(word))
+	}
+
+	first := ""
+	for _, v := range texts {
+		s, ok := textValue(v)
+		if !ok {
+			continue
+		}
+		if first == "" {
+			first = s
+		}
+		if snippet, ok := highlight(s, words); ok {
+			return snippet
+		}
+	}
+	text := []rune(first)
+	if len(text) > snippetLength {
+		return string(text[:snippetLength]) + "…"
+	}
+	return first
+}
+
+// highlight marks the words in s, showing the part around the first match
+func highlight(s string, words [][]rune) (string, bool) {
+	text := []rune(s)
+	folded := []rune(zh.Fold(s))
+	matched := make([]bool, len(text))
+	firstMatch := -1
+	for _, word := range words {
+		for i := 0; i+len(word) <= len(folded); i++ {
+			if slices.Equal(folded[i:i+len(word)], word) {
+				for j := i; j < i+len(word); j++ {
+					matched[j] = true
+				}
+				if firstMatch < 0 || i < firstMatch {
+					firstMatch = i
+				}
+			}
+		}
+	}
+	if firstMatch < 0 {
+		return "", false
+	}
+
+	start := max(0, min(firstMatch-snippetLength/4, len(text)-snippetLength))
+	end := min(len(text), start+snippetLength)
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("…")
+	}
+	for i := start; i < end; i++ {
+		if matched[i] && (i == start || !matched[i-1]) {
+			b.WriteString(highlightStart)
+		}
+		b.WriteRune(text[i])
+		if matched[i] && (i == end-1 || !matched[i+1]) {
+			b.WriteString(highlightEnd)
+		}
+	}
+	if end < len(text) {
+		b.WriteString("…")
+	}
+	return b.String(), true
+}
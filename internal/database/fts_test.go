@@ -0,0 +1,97 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestSearch(t *testing.T) {
+	ctx := context.Background()
+	m := newTestManager(t)
+	if err := m.CreateAndInsert("notes", [][]string{
+		{"客户", "备注"},
+		{"张三", "退款失败，请尽快处理退款申请"},
+		{"李四", "已发货 顺丰快递"},
+		{"王五", "客户要求退货并退款，原因：商品破损"},
+		{"孙七", "發貨延遲，客戶投訴"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.ExecuteQuery(ctx, "SELECT * FROM search(notes, '退款');"); err == nil {
+		t.Error("searching a table without an index should fail")
+	}
+	n, err := m.CreateSearchIndex(ctx, "notes", []string{"备注"})
+	if errors.Is(err, errNoFTS5) {
+		t.Skip("SQLite without FTS5, run the tests with -tags sqlite_fts5")
+	}
+	if err != nil {
+		t.Fatalf("CreateSearchIndex() error = %v", err)
+	}
+	if n != 4 {
+		t.Errorf("CreateSearchIndex() = %d rows, want 4", n)
+	}
+	if indexes, err := m.SearchIndexes(); err != nil || !reflect.DeepEqual(indexes, []SearchIndex{{"notes", []string{"_2"}}}) {
+		t.Errorf("SearchIndexes() = %v, %v", indexes, err)
+	}
+
+	tests := []struct {
+		query string
+		want  [][]any
+	}{
+		// The row mentioning 退款 twice ranks first
+		{"退款", [][]any{{"张三", "【退款】失败，请尽快处理【退款】申请"}, {"王五", "客户要求退货并【退款】，原因：商品破损"}}},
+		{"发货", [][]any{{"李四", "已【发货】 顺丰快递"}, {"孙七", "【發貨】延遲，客戶投訴"}}},
+		{"退 破损", [][]any{{"王五", "客户要求【退】货并【退】款，原因：商品【破损】"}}},
+		{"快递 OR 投诉", [][]any{{"李四", "已发货 顺丰【快递】"}, {"孙七", "發貨延遲，客戶【投訴】"}}},
+		{"款申请", [][]any{{"张三", "退款失败，请尽快处理退【款申请】"}}},
+		{"退货 申请", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			result, err := m.ExecuteQuery(ctx, "SELECT 客户, snippet FROM search(notes, '"+tt.query+"');")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(result.Rows, tt.want) {
+				t.Errorf("search = %v, want %v", result.Rows, tt.want)
+			}
+		})
+	}
+
+	// Re-importing the table drops its index
+	if _, err := m.ReplaceAndInsertRows("notes", func(yield func([]string, error) bool) {
+		_ = yield([]string{"客户", "备注"}, nil) && yield([]string{"周八", "退款"}, nil)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.ExpandSearches("SELECT * FROM search(notes, '退款');"); err == nil {
+		t.Error("the index of a re-imported table should be dropped")
+	}
+
+	// Dropping the table drops its index
+	if _, err := m.CreateSearchIndex(ctx, "notes", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.DropTable("notes"); err != nil {
+		t.Fatal(err)
+	}
+	if exists, err := m.TableExists(searchIndexName("notes")); err != nil || exists {
+		t.Errorf("index of a dropped table exists = %v, %v, want it dropped", exists, err)
+	}
+}
+
+func TestExpandSearches(t *testing.T) {
+	m := newTestManager(t)
+	tests := []string{
+		"SELECT 'search(notes, ''a'')';",
+		"SELECT search FROM t -- search(notes, 'a')",
+		"SELECT search(notes) FROM t;",
+	}
+	for _, in := range tests {
+		if got, err := m.ExpandSearches(in); err != nil || got != in {
+			t.Errorf("ExpandSearches(%q) = %q, %v, want it unchanged", in, got, err)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"strings"
+
+	sqlite3 "github.com/mattn/go-sqlite3"
+
+	"csvsql/internal/zh"
+)
+
+// DriverName is the database/sql driver for SQLite connections with the
+// SQL functions of csvsql registered
+const DriverName = "sqlite3_csvsql"
+
+func init() {
+	sql.Register(DriverName, &sqlite3.SQLiteDriver{ConnectHook: registerFunctions})
+}
+
+// scalarFunctions are the SQL functions added to every connection, by name.
+// They return NULL for NULL arguments.
+var scalarFunctions = map[string]any{
+	"pinyin":           pinyin,
+	"pinyin_initials":  textFunction(func(s string) any { return zh.PinyinInitials(s) }),
+	"cn_number":        textFunction(cnNumber),
+	"cn_date":          textFunction(cnDate),
+	"idcard_valid":     textFunction(func(s string) any { _, ok := zh.ParseIDCard(s); return ok }),
+	"idcard_birthdate": textFunction(idCardBirthdate),
+	"idcard_gender":    textFunction(idCardGender),
+	"phone_mask":       textFunction(func(s string) any { return zh.MaskPhone(s) }),
+	"to_halfwidth":     textFunction(func(s string) any { return zh.ToHalfwidth(s) }),
+	"t2s":              textFunction(func(s string) any { return zh.ToSimplified(s) }),
+	"s2t":              textFunction(func(s string) any { return zh.ToTraditional(s) }),
+	"regexp":           regexpMatch,
+	"regexp_replace":   regexpReplace,
+	"regexp_extract":   regexpExtract,
+	"split_part":       splitPart,
+	"levenshtein":      levenshtein,
+	"similarity":       similarity,
+	// Used by the full-text search of search(table, 'query')
+	"fts_tokens":  textFunction(ftsTokens),
+	"fts_snippet": ftsSnippet,
+}
+
+// Collations orders text for Chinese readers, by name as in ORDER BY name
+// COLLATE PINYIN. SQLite matches collation names ignoring case.
+var Collations = map[string]func(a, b string) int{
+	"PINYIN": zh.ComparePinyin,
+	"STROKE": zh.CompareStrokes,
+}
+
+// registerFunctions adds the SQL functions and collations of csvsql to a
+// new connection
+func registerFunctions(conn *sqlite3.SQLiteConn) error {
+	for name, impl := range scalarFunctions {
+		if err := conn.RegisterFunc(name, impl, true); err != nil {
+			return fmt.Errorf("register function %s: %w", name, err)
+		}
+	}
+	for name, impl := range aggregateFunctions {
+		if err := conn.RegisterAggregator(name, impl, true); err != nil {
+			return fmt.Errorf("register aggregate %s: %w", name, err)
+		}
+	}
+	for name, compare := range Collations {
+		if err := conn.RegisterCollation(name, compare); err != nil {
+			return fmt.Errorf("register collation %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// textFunction adapts a function of one text argument. Numbers are passed
+// as text, so that idcard_valid(110105194912310021) works on an INTEGER
+// column; NULL gives NULL.
+func textFunction(f func(string) any) func(any) any {
+	return func(v any) any {
+		s, ok := textValue(v)
+		if !ok {
+			return nil
+		}
+		return f(s)
+	}
+}
+
+// textValue returns an argument as text; false for NULL, which the driver
+// passes as a nil []byte
+func textValue(v any) (string, bool) {
+	if b, ok := v.([]byte); ok && b == nil {
+		return "", false
+	}
+	return FormatValue(v, ""), true
+}
+
+// pinyin(s [, style]) spells Chinese characters in pinyin; style is plain
+// (zhang san, the default), tone (zhāng sān) or number (zhang1 san1)
+func pinyin(v any, options ...any) (any, error) {
+	s, ok := textValue(v)
+	if !ok {
+		return nil, nil
+	}
+	style := zh.PinyinPlain
+	if len(options) > 0 {
+		name, _ := textValue(options[0])
+		switch strings.ToLower(name) {
+		case "plain":
+		case "tone":
+			style = zh.PinyinTone
+		case "number":
+			style = zh.PinyinNumber
+		default:
+			return nil, fmt.Errorf("pinyin: unknown style %q, expected plain, tone or number", name)
+		}
+	}
+	return zh.Pinyin(s, style), nil
+}
+
+// cnNumber reads Chinese numerals, giving an INTEGER for whole numbers and
+// NULL for text that is not a number
+func cnNumber(s string) any {
+	n, ok := zh.ParseNumber(s)
+	if !ok {
+		return nil
+	}
+	if n == math.Trunc(n) && math.Abs(n) < 1<<53 {
+		return int64(n)
+	}
+	return n
+}
+
+// cnDate writes a date in one of the formats common in Chinese data as
+// ISO-8601 text, or NULL
+func cnDate(s string) any {
+	if iso, ok := (&zh.DateParser{}).Parse(s, false); ok {
+		return iso
+	}
+	return nil
+}
+
+// idCardBirthdate returns the birthdate of a valid identity card number as
+// ISO-8601 text, or NULL
+func idCardBirthdate(s string) any {
+	card, ok := zh.ParseIDCard(s)
+	if !ok {
+		return nil
+	}
+	return card.Birthdate.Format("2006-01-02")
+}
+
+// idCardGender returns 男 or 女 for a valid identity card number, or NULL
+func idCardGender(s string) any {
+	card, ok := zh.ParseIDCard(s)
+	switch {
+	case !ok:
+		return nil
+	case card.Male:
+		return "男"
+	default:
+		return "女"
+	}
+}
@@ -0,0 +1,99 @@
+package database
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFunctions(t *testing.T) {
+	m := newTestManager(t)
+	result, err := m.ExecuteQuery(context.Background(), `SELECT pinyin('张三'), pinyin('张三', 'tone'), pinyin_initials('张三'),
+		cn_number('一万二千三'), cn_number('三点一四'), cn_number('n/a'), cn_date('2024年3月5日'),
+		idcard_valid(110105194912310021), idcard_birthdate('11010519491231002X'), idcard_gender('11010519491231002X'),
+		phone_mask('13812345678'), to_halfwidth('ＡＢ１'), t2s('發展'), s2t('发展'), pinyin(NULL);`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []any{"zhang san", "zhāng sān", "zs", int64(12300), 3.14, nil, "2024-03-05",
+		int64(0), "1949-12-31", "女", "138****5678", "AB1", "发展", "發展", nil}
+	if !reflect.DeepEqual(result.Rows[0], want) {
+		t.Errorf("functions = %#v, want %#v", result.Rows[0], want)
+	}
+
+	if _, err := m.ExecuteQuery(context.Background(), "SELECT pinyin('张三', 'upper');"); err == nil {
+		t.Error("pinyin() should reject unknown styles")
+	}
+}
+
+func TestTextFunctions(t *testing.T) {
+	m := newTestManager(t)
+	result, err := m.ExecuteQuery(context.Background(), `SELECT 'abc123' REGEXP '\d+$', '订单A' REGEXP '^\d',
+		regexp_replace('2024-01-02', '(\d+)-(\d+)-(\d+)', '$3/$2/$1'), regexp_extract('电话 138-1234', '(\d+)-(\d+)', 2),
+		regexp_extract('无', '\d'), split_part('a,b,c', ',', 2), split_part('a,b,c', ',', -1), split_part('a,b', ',', 5),
+		levenshtein('kitten', 'sitting'), round(similarity('北京市', '北京'), 4), similarity('', ''), levenshtein(NULL, 'a'),
+		split_part('a,b,c', ',', '2'), split_part('a,b', ',', 1.0), split_part('a', ',', NULL), regexp_extract('x-9', '(\w)-(\d)', ' 2'),
+		regexp_extract('x-9', '(\w)-(\d)', NULL);`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []any{int64(1), int64(0), "02/01/2024", "1234", nil, "b", "c", "", int64(3), 0.6667, 1.0, nil, "b", "a", nil, "9", nil}
+	if !reflect.DeepEqual(result.Rows[0], want) {
+		t.Errorf("functions = %#v, want %#v", result.Rows[0], want)
+	}
+
+	tests := []struct {
+		query   string
+		wantErr string
+	}{
+		{"SELECT 'a' REGEXP '(';", "missing closing )"},
+		{"SELECT regexp_extract('a', 'a', 1);", "has no group 1"},
+		{"SELECT regexp_extract('a', 'a', 'one');", "group must be a whole number"},
+		{"SELECT split_part('a', ',', 0);", "start at 1"},
+		{"SELECT split_part('a', ',', 1.5);", "must be a whole number"},
+	}
+	for _, tt := range tests {
+		if _, err := m.ExecuteQuery(context.Background(), tt.query); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s error = %v, want %q", tt.query, err, tt.wantErr)
+		}
+	}
+}
+
+func TestCollations(t *testing.T) {
+	m := newTestManager(t)
+	if err := m.SetChineseCollation("pinyin"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.CreateAndInsert("c", [][]string{{"名称", "code"}, {"张三", "张三"}, {"李四", "李四"}, {"阿里", "阿里"}, {"马六", "马六"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		// The column of a Chinese header has the default collation
+		{"SELECT 名称 FROM c ORDER BY 名称;", []string{"阿里", "李四", "马六", "张三"}},
+		{"SELECT code FROM c ORDER BY code;", []string{"张三", "李四", "阿里", "马六"}},
+		{"SELECT code FROM c ORDER BY code COLLATE PINYIN;", []string{"阿里", "李四", "马六", "张三"}},
+		{"SELECT code FROM c ORDER BY code COLLATE stroke;", []string{"马六", "张三", "李四", "阿里"}},
+	}
+	for _, tt := range tests {
+		result, err := m.ExecuteQuery(context.Background(), tt.query)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.query, err)
+		}
+		var got []string
+		for _, row := range result.Rows {
+			got = append(got, row[0].(string))
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+
+	if err := m.SetChineseCollation("unicode"); err == nil {
+		t.Error("SetChineseCollation() should reject unknown collations")
+	}
+}
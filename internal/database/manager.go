@@ -1,42 +1,435 @@
 package database
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"iter"
+	"net/url"
+	"path/filepath"
 	"strings"
+	"sync/atomic"
 
 	"csvsql/internal/mapping"
+	"csvsql/pkg/format"
 	"csvsql/pkg/utils"
 )
 
+// ErrEmptyData is returned when a table would be created without a header row
+var ErrEmptyData = errors.New("cannot create table from empty data")
+
 // Manager handles database operations
 type Manager struct {
-	db     *sql.DB
-	mapper *mapping.Mapper
+	db         atomic.Pointer[sql.DB] // switched by Open while a watcher may import
+	mapper     *mapping.Mapper
+	nullTokens map[string]bool // cell values stored as NULL
+	collation  string          // collation of new columns with Chinese headers
+	functions  map[string]*userFunction
+	registered map[string]bool // names of user functions on the connection, dropped ones included
+	macros     map[string]Definition
 }
 
 // NewManager creates a new database manager
 func NewManager(db *sql.DB, mapper *mapping.Mapper) *Manager {
-	return &Manager{
-		db:     db,
-		mapper: mapper,
+	m := &Manager{
+		mapper:     mapper,
+		functions:  make(map[string]*userFunction),
+		registered: make(map[string]bool),
+		macros:     make(map[string]Definition),
+	}
+	m.db.Store(db)
+	return m
+}
+
+// SetNullTokens sets the cell values that are stored as SQL NULL when rows
+// are imported, e.g. "", "NA" or "无". Missing cells of short rows are
+// stored like empty cells.
+func (m *Manager) SetNullTokens(tokens []string) {
+	m.nullTokens = make(map[string]bool, len(tokens))
+	for _, token := range tokens {
+		m.nullTokens[token] = true
+	}
+}
+
+// SetChineseCollation sets the collation, one of Collations, of the columns
+// created for Chinese headers, so that they sort in pinyin or stroke order
+// without COLLATE in every query. The empty name keeps SQLite's binary
+// order.
+func (m *Manager) SetChineseCollation(name string) error {
+	collation := strings.ToUpper(name)
+	if _, ok := Collations[collation]; !ok && collation != "" {
+		return fmt.Errorf("unknown collation %q, expected pinyin or stroke", name)
 	}
+	m.collation = collation
+	return nil
+}
+
+// columnType declares a new column for a header
+func (m *Manager) columnType(header string) string {
+	if m.collation != "" && utils.ContainsChinese(header) {
+		return "TEXT COLLATE " + m.collation
+	}
+	return "TEXT"
+}
+
+// cellValue returns the value stored for the cell at position i of a row
+func (m *Manager) cellValue(row []string, i int) interface{} {
+	cell := ""
+	if i < len(row) {
+		cell = row[i]
+	}
+	if m.nullTokens[cell] {
+		return nil
+	}
+	return cell
 }
 
 // CreateAndInsert creates a table and inserts data using a transaction
 func (m *Manager) CreateAndInsert(tableName string, data [][]string) error {
 	if len(data) == 0 {
-		return fmt.Errorf("cannot create table from empty data")
+		return ErrEmptyData
+	}
+
+	_, err := m.CreateAndInsertRows(tableName, func(yield func([]string, error) bool) {
+		for _, row := range data {
+			if !yield(row, nil) {
+				return
+			}
+		}
+	})
+	return err
+}
+
+// CreateAndInsertRows creates a table from the first record (the header) and
+// streams the remaining records into it within one transaction. Rows are
+// padded or truncated to the header width. It returns the number of rows inserted.
+func (m *Manager) CreateAndInsertRows(tableName string, records iter.Seq2[[]string, error]) (int, error) {
+	return m.insertRows(tableName, records, false)
+}
+
+// ReplaceAndInsertRows works like CreateAndInsertRows but first drops an
+// existing table of the same name and its mappings. The old table is kept
+// if loading the new records fails.
+func (m *Manager) ReplaceAndInsertRows(tableName string, records iter.Seq2[[]string, error]) (int, error) {
+	return m.insertRows(tableName, records, true)
+}
+
+// insertRows creates a table from records, optionally replacing an existing one
+func (m *Manager) insertRows(tableName string, records iter.Seq2[[]string, error], replace bool) (n int, err error) {
+	tx, err := m.begin(context.Background())
+	if err != nil {
+		return 0, err
+	}
+
+	// Mappings are rebuilt from the new header and restored if loading fails
+	oldMappings := m.mapper.GetTableMappings(tableName)
+	defer func() {
+		if err != nil {
+			m.mapper.SetTableMappings(tableName, oldMappings)
+		}
+	}()
+
+	if replace {
+		m.mapper.RemoveTable(tableName)
+		if _, err := tx.Exec(fmt.Sprintf("DROP TABLE IF EXISTS %s;", tableName)); err != nil {
+			tx.Rollback()
+			return 0, fmt.Errorf("drop table failed: %w", err)
+		}
+		// The full-text index would point at the old rows
+		if _, err := tx.Exec(fmt.Sprintf("DROP TABLE IF EXISTS %s;", searchIndexName(tableName))); err != nil {
+			tx.Rollback()
+			return 0, fmt.Errorf("drop full-text index failed: %w", err)
+		}
+	}
+
+	var headers []string
+	var stmt *sql.Stmt
+	count := 0
+
+	for row, err := range records {
+		if err != nil {
+			tx.Rollback() // Rollback on any error
+			return 0, err
+		}
+
+		if headers == nil {
+			headers = m.sanitizeHeaders(tableName, row)
+
+			// Create the table
+			columnDefs := make([]string, len(headers))
+			for i, h := range headers {
+				columnDefs[i] = h + " " + m.columnType(row[i])
+			}
+			query := fmt.Sprintf("CREATE TABLE %s (%s);", tableName, strings.Join(columnDefs, ", "))
+			if _, err := tx.Exec(query); err != nil {
+				tx.Rollback()
+				return 0, fmt.Errorf("create table failed: %w", err)
+			}
+			if err := m.saveMappings(tx, tableName); err != nil {
+				tx.Rollback()
+				return 0, err
+			}
+
+			placeholders := strings.Repeat("?,", len(headers))
+			placeholders = placeholders[:len(placeholders)-1] // remove trailing comma
+			stmt, err = tx.Prepare(fmt.Sprintf("INSERT INTO %s VALUES (%s)", tableName, placeholders))
+			if err != nil {
+				tx.Rollback()
+				return 0, err
+			}
+			defer stmt.Close()
+			continue
+		}
+
+		rowInterface := make([]interface{}, len(headers))
+		for i := range rowInterface {
+			rowInterface[i] = m.cellValue(row, i)
+		}
+		if _, err := stmt.Exec(rowInterface...); err != nil {
+			tx.Rollback() // Rollback on any error
+			return 0, err
+		}
+		count++
+	}
+
+	if headers == nil {
+		tx.Rollback()
+		return 0, ErrEmptyData
+	}
+
+	return count, tx.Commit()
+}
+
+// AppendRows inserts records into an existing table. The header (the first
+// record) is matched to the table's columns by name, Chinese headers through
+// their mapping, so the columns of the new file may come in any order.
+func (m *Manager) AppendRows(tableName string, records iter.Seq2[[]string, error]) (int, error) {
+	result, err := m.mergeRows(tableName, records, "", false)
+	return result.Inserted, err
+}
+
+// MergeResult reports what MergeRows changed
+type MergeResult struct {
+	Inserted     int
+	Updated      int
+	AddedColumns []string // headers of columns added to the table
+}
+
+// MergeRows merges records into an existing table. Headers are matched to
+// columns like AppendRows, and columns for unknown headers are added to the
+// table. With an empty key every row is inserted; otherwise a row whose
+// value in the key column (given by header or column name) matches existing
+// rows updates them, and other rows are inserted.
+func (m *Manager) MergeRows(tableName string, records iter.Seq2[[]string, error], key string) (MergeResult, error) {
+	return m.mergeRows(tableName, records, key, true)
+}
+
+func (m *Manager) mergeRows(tableName string, records iter.Seq2[[]string, error], key string, addColumns bool) (result MergeResult, err error) {
+	existing, err := m.tableColumns(tableName)
+	if err != nil {
+		return result, err
+	}
+
+	tx, err := m.begin(context.Background())
+	if err != nil {
+		return result, err
+	}
+
+	// Mappings of added columns are dropped again if merging fails
+	oldMappings := m.mapper.GetTableMappings(tableName)
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			m.mapper.SetTableMappings(tableName, oldMappings)
+		}
+	}()
+
+	var columns []string
+	var insert, update *sql.Stmt
+	keyIndex := -1
+	index := "" // temporary index on the key column
+
+	for row, err := range records {
+		if err != nil {
+			return result, err
+		}
+
+		if columns == nil {
+			if columns, err = m.mergeColumns(tx, tableName, row, existing, addColumns, &result); err != nil {
+				return result, err
+			}
+
+			placeholders := strings.Repeat("?,", len(columns))
+			placeholders = placeholders[:len(placeholders)-1] // remove trailing comma
+			query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", tableName, strings.Join(columns, ", "), placeholders)
+			if insert, err = tx.Prepare(query); err != nil {
+				return result, err
+			}
+			defer insert.Close()
+
+			if key != "" {
+				if keyIndex, err = m.keyColumn(tableName, key, columns); err != nil {
+					return result, err
+				}
+				if update, index, err = prepareUpdate(tx, tableName, columns, columns[keyIndex]); err != nil {
+					return result, err
+				}
+				defer update.Close()
+			}
+			continue
+		}
+
+		values := make([]interface{}, len(columns))
+		for i := range values {
+			values[i] = m.cellValue(row, i)
+		}
+
+		if update != nil {
+			res, err := update.Exec(append(values, values[keyIndex])...)
+			if err != nil {
+				return result, err
+			}
+			if affected, _ := res.RowsAffected(); affected > 0 {
+				result.Updated++
+				continue
+			}
+		}
+		if _, err := insert.Exec(values...); err != nil {
+			return result, err
+		}
+		result.Inserted++
+	}
+
+	if columns == nil {
+		return result, ErrEmptyData
+	}
+	if index != "" {
+		if _, err := tx.Exec(fmt.Sprintf("DROP INDEX %s;", index)); err != nil {
+			return result, err
+		}
+	}
+
+	return result, tx.Commit()
+}
+
+// mergeColumns maps an incoming header to the columns of a table, adding a
+// column for every unknown header when addColumns is set
+func (m *Manager) mergeColumns(tx *sql.Tx, tableName string, header []string, existing map[string]bool, addColumns bool, result *MergeResult) ([]string, error) {
+	columns := make([]string, len(header))
+	for i, h := range header {
+		column, ok := m.columnForHeader(tableName, h)
+		if ok && existing[column] {
+			columns[i] = column
+			continue
+		}
+		if !addColumns {
+			return nil, fmt.Errorf("column %q not found in table %s", h, tableName)
+		}
+
+		if utils.ContainsChinese(h) {
+			// Chinese headers get the next free positional column name
+			for n := len(existing) + 1; ; n++ {
+				if column = fmt.Sprintf("_%d", n); !existing[column] {
+					break
+				}
+			}
+			m.mapper.AddMapping(tableName, h, column)
+		}
+		if _, err := tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s;", tableName, column, m.columnType(h))); err != nil {
+			return nil, fmt.Errorf("add column %s failed: %w", h, err)
+		}
+		existing[column] = true
+		columns[i] = column
+		result.AddedColumns = append(result.AddedColumns, h)
 	}
 
-	headers := data[0]
+	if len(result.AddedColumns) > 0 {
+		if err := m.saveMappings(tx, tableName); err != nil {
+			return nil, err
+		}
+	}
+	return columns, nil
+}
+
+// keyColumn finds the position of the key, given as header or column name,
+// among the columns of an incoming file
+func (m *Manager) keyColumn(tableName, key string, columns []string) (int, error) {
+	column, ok := m.columnForHeader(tableName, key)
+	for i, c := range columns {
+		if (ok && c == column) || c == key {
+			return i, nil
+		}
+	}
+	return -1, fmt.Errorf("key column %s is not in the imported file", key)
+}
+
+// prepareUpdate prepares a statement setting columns of the rows matching
+// the key column, after indexing the key so each update avoids a table scan.
+// The index is returned so the merge can drop it again, or empty if it
+// existed before.
+func prepareUpdate(tx *sql.Tx, tableName string, columns []string, key string) (*sql.Stmt, string, error) {
+	index := fmt.Sprintf("%s_%s_key", tableName, key)
+	var count int
+	if err := tx.QueryRow("SELECT count(*) FROM sqlite_master WHERE type='index' AND name=?;", index).Scan(&count); err != nil {
+		return nil, "", err
+	}
+	if count > 0 {
+		index = ""
+	} else if _, err := tx.Exec(fmt.Sprintf("CREATE INDEX %s ON %s (%s);", index, tableName, key)); err != nil {
+		return nil, "", err
+	}
+
+	assignments := make([]string, len(columns))
+	for i, c := range columns {
+		assignments[i] = c + " = ?"
+	}
+	stmt, err := tx.Prepare(fmt.Sprintf("UPDATE %s SET %s WHERE %s = ?", tableName, strings.Join(assignments, ", "), key))
+	return stmt, index, err
+}
+
+// tableColumns returns the set of column names of a table
+func (m *Manager) tableColumns(tableName string) (map[string]bool, error) {
+	rows, err := m.db.Load().Query(fmt.Sprintf("PRAGMA table_info(%s);", tableName))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns := make(map[string]bool)
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var dflt sql.NullString
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dflt, &pk); err != nil {
+			return nil, err
+		}
+		columns[name] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("no such table: %s", tableName)
+	}
+	return columns, nil
+}
 
-	// Initialize mapping for this table (no need to add empty mapping)
+// columnForHeader finds the column name a header was stored under
+func (m *Manager) columnForHeader(tableName, header string) (string, bool) {
+	if utils.ContainsChinese(header) {
+		return m.mapper.GetColumnName(tableName, header)
+	}
+	return utils.SanitizeColumnName(header), true
+}
 
-	// Sanitize headers for use as column names
+// sanitizeHeaders turns headers into valid column names, recording a mapping
+// for every Chinese header
+func (m *Manager) sanitizeHeaders(tableName string, row []string) []string {
+	headers := make([]string, len(row))
 	sanitizedHeaders := make(map[string]int)
 
-	for i, h := range headers {
+	for i, h := range row {
 		originalHeader := h
 
 		// Check if header contains Chinese characters
@@ -62,39 +455,78 @@ func (m *Manager) CreateAndInsert(tableName string, data [][]string) error {
 			}
 		}
 	}
+	return headers
+}
 
-	// Create the table
-	columnDefs := make([]string, len(headers))
-	for i, h := range headers {
-		columnDefs[i] = h + " TEXT"
+// ExecuteQuery runs the user's SQL, which may hold several statements, and
+// reads the whole result of the last one. Chinese headers in the query are
+// translated to column names and restored in the result.
+func (m *Manager) ExecuteQuery(ctx context.Context, query string) (*Result, error) {
+	var result *Result
+	for st, err := range m.Run(ctx, query) {
+		if err != nil {
+			return nil, err
+		}
+		result = st.Result
+		if st.Rows != nil {
+			if result, err = st.Rows.collect(); err != nil {
+				return nil, err
+			}
+		}
 	}
-	query := fmt.Sprintf("CREATE TABLE %s (%s);", tableName, strings.Join(columnDefs, ", "))
-	if _, err := m.db.Exec(query); err != nil {
-		return fmt.Errorf("create table failed: %w", err)
+	if result == nil {
+		return &Result{}, nil
 	}
+	return result, nil
+}
 
-	// Insert data in a transaction for efficiency
-	tx, err := m.db.Begin()
+// QueryRows runs a statement returning rows and streams its result. The
+// database connection stays busy until the rows are read or closed, and
+// cancelling ctx interrupts the statement.
+func (m *Manager) QueryRows(ctx context.Context, query string) (*Rows, error) {
+	st, err := m.Execute(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	if st.Rows == nil {
+		return nil, errNoRows
+	}
+	return st.Rows, nil
+}
+
+// Reject describes an input row that could not be loaded cleanly
+type Reject = format.Reject
+
+// RejectsTable is the table that collects rejected rows from every import
+const RejectsTable = "_rejects"
+
+// RecordRejects appends rejected rows of a source file to the rejects table,
+// creating the table on first use
+func (m *Manager) RecordRejects(tableName, source string, rejects []Reject) error {
+	if len(rejects) == 0 {
+		return nil
+	}
+
+	query := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (table_name TEXT, source TEXT, line INTEGER, raw TEXT, reason TEXT);", RejectsTable)
+	if _, err := m.db.Load().Exec(query); err != nil {
+		return fmt.Errorf("create rejects table failed: %w", err)
+	}
+
+	tx, err := m.begin(context.Background())
 	if err != nil {
 		return err
 	}
 
-	placeholders := strings.Repeat("?,", len(headers))
-	placeholders = placeholders[:len(placeholders)-1] // remove trailing comma
-	stmt, err := tx.Prepare(fmt.Sprintf("INSERT INTO %s VALUES (%s)", tableName, placeholders))
+	stmt, err := tx.Prepare(fmt.Sprintf("INSERT INTO %s VALUES (?, ?, ?, ?, ?)", RejectsTable))
 	if err != nil {
+		tx.Rollback()
 		return err
 	}
 	defer stmt.Close()
 
-	for _, row := range data[1:] { // Skip header row
-		rowInterface := make([]interface{}, len(row))
-		for i, v := range row {
-			rowInterface[i] = v
-		}
-		_, err := stmt.Exec(rowInterface...)
-		if err != nil {
-			tx.Rollback() // Rollback on any error
+	for _, r := range rejects {
+		if _, err := stmt.Exec(tableName, source, r.Line, r.Raw, r.Reason); err != nil {
+			tx.Rollback()
 			return err
 		}
 	}
@@ -102,67 +534,120 @@ func (m *Manager) CreateAndInsert(tableName string, data [][]string) error {
 	return tx.Commit()
 }
 
-// ExecuteQuery runs the user's SQL query and returns the result
-func (m *Manager) ExecuteQuery(query string) ([][]string, error) {
-	// Translate Chinese field names before executing the query
-	translatedQuery := m.mapper.TranslateQuery(query)
+// AttachDatabase attaches an existing SQLite database file read-only under the given schema name
+func (m *Manager) AttachDatabase(filePath, schema string) error {
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		return err
+	}
+	uri := url.URL{Scheme: "file", Path: filepath.ToSlash(absPath), RawQuery: "mode=ro"}
+	if _, err := m.db.Load().Exec(fmt.Sprintf("ATTACH DATABASE ? AS %s;", schema), uri.String()); err != nil {
+		return fmt.Errorf("attach database failed: %w", err)
+	}
+	// Databases saved by csvsql bring their Chinese headers along
+	if err := m.restoreAttachedMappings(schema); err != nil {
+		return fmt.Errorf("read header mappings of %s failed: %w", schema, err)
+	}
+	return nil
+}
 
-	trimmedQuery := strings.ToUpper(strings.TrimSpace(translatedQuery))
-	// For non-SELECT queries (INSERT, UPDATE, DELETE)
-	if !strings.HasPrefix(trimmedQuery, "SELECT") && !strings.HasPrefix(trimmedQuery, "PRAGMA") {
-		res, err := m.db.Exec(translatedQuery)
-		if err != nil {
-			return nil, err
-		}
-		affected, _ := res.RowsAffected()
-		return nil, fmt.Errorf("query OK, %d rows affected", affected)
+// DetachDatabase detaches a database attached with AttachDatabase and
+// forgets the header mappings of its tables
+func (m *Manager) DetachDatabase(schema string) error {
+	tables, err := m.TableNames(schema)
+	if err != nil {
+		return err
+	}
+	if _, err := m.db.Load().Exec(fmt.Sprintf("DETACH DATABASE %s;", schema)); err != nil {
+		return fmt.Errorf("detach database failed: %w", err)
 	}
+	for _, tableName := range tables {
+		m.mapper.RemoveTable(schema + "." + tableName)
+	}
+	return nil
+}
 
-	// For SELECT queries
-	rows, err := m.db.Query(translatedQuery)
+// TableNames returns the tables of a schema in name order, leaving out the
+// bookkeeping tables of csvsql and SQLite
+func (m *Manager) TableNames(schema string) ([]string, error) {
+	query := fmt.Sprintf(`SELECT name FROM %s.sqlite_master WHERE type='table'
+AND substr(name, 1, %d) != '%s' AND substr(name, 1, 7) != 'sqlite_' AND name != '%s' ORDER BY name;`,
+		schema, len(CatalogPrefix), CatalogPrefix, RejectsTable)
+	rows, err := m.db.Load().Query(query)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	columns, err := rows.Columns()
+	var tables []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		tables = append(tables, name)
+	}
+	return tables, rows.Err()
+}
+
+// AttachedSchemas returns the names of all attached databases except main and temp
+func (m *Manager) AttachedSchemas() ([]string, error) {
+	rows, err := m.db.Load().Query("PRAGMA database_list;")
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
-	// Restore Chinese headers by reversing the mapping
-	restoredColumns := m.mapper.RestoreHeaders(columns)
-
-	var resultsData [][]string
-	resultsData = append(resultsData, restoredColumns) // Add restored headers as the first row
-
+	var schemas []string
 	for rows.Next() {
-		rowValues := make([]interface{}, len(columns))
-		rowScanners := make([]interface{}, len(columns))
-		for i := range rowValues {
-			rowScanners[i] = &rowValues[i]
-		}
-
-		if err := rows.Scan(rowScanners...); err != nil {
+		var seq int
+		var name, file string
+		if err := rows.Scan(&seq, &name, &file); err != nil {
 			return nil, err
 		}
-
-		rowStr := make([]string, len(columns))
-		for i, val := range rowValues {
-			if val == nil {
-				rowStr[i] = "NULL"
-			} else {
-				rowStr[i] = fmt.Sprintf("%s", val)
-			}
+		if name != "main" && name != "temp" {
+			schemas = append(schemas, name)
 		}
-		resultsData = append(resultsData, rowStr)
 	}
+	return schemas, rows.Err()
+}
 
-	if err := rows.Err(); err != nil {
-		return nil, err
+// ExecScript executes a script of one or more SQL statements as-is
+func (m *Manager) ExecScript(script string) error {
+	_, err := m.db.Load().Exec(script)
+	return err
+}
+
+// DropTable drops a table together with its full-text index, mappings and
+// rejected rows
+func (m *Manager) DropTable(tableName string) error {
+	for _, table := range []string{tableName, searchIndexName(tableName)} {
+		if _, err := m.db.Load().Exec(fmt.Sprintf("DROP TABLE IF EXISTS %s;", table)); err != nil {
+			return err
+		}
+	}
+	m.mapper.RemoveTable(tableName)
+	if err := m.saveMappings(m.db.Load(), tableName); err != nil {
+		return err
 	}
+	return m.ClearRejects(tableName)
+}
+
+// TableExists reports whether a table exists in the main database
+func (m *Manager) TableExists(tableName string) (bool, error) {
+	var count int
+	err := m.db.Load().QueryRow("SELECT count(*) FROM sqlite_master WHERE type='table' AND name=?;", tableName).Scan(&count)
+	return count > 0, err
+}
 
-	return resultsData, nil
+// ClearRejects removes the rejected rows recorded for a table
+func (m *Manager) ClearRejects(tableName string) error {
+	exists, err := m.TableExists(RejectsTable)
+	if err != nil || !exists {
+		return err
+	}
+	_, err = m.db.Load().Exec(fmt.Sprintf("DELETE FROM %s WHERE table_name=?;", RejectsTable), tableName)
+	return err
 }
 
 // GetMapper returns the Chinese header mapper
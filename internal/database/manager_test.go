@@ -0,0 +1,132 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"testing"
+	"time"
+
+	"csvsql/internal/mapping"
+)
+
+// newTestManager creates a manager for an in-memory database
+func newTestManager(t *testing.T) *Manager {
+	t.Helper()
+	db, err := sql.Open(DriverName, ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	return NewManager(db, mapping.NewMapper())
+}
+
+func TestExecuteQueryResult(t *testing.T) {
+	m := newTestManager(t)
+	if err := m.CreateAndInsert("people", [][]string{{"姓名", "age"}, {"张三", "30"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	insert, err := m.ExecuteQuery(context.Background(), "INSERT INTO people (姓名, age) VALUES ('李四', '40'), ('王五', NULL);")
+	if err != nil {
+		t.Fatalf("ExecuteQuery(INSERT) error = %v", err)
+	}
+	if insert.HasRows() || insert.RowsAffected != 2 || insert.LastInsertID != 3 {
+		t.Errorf("INSERT result = %+v, want 2 rows affected and last insert id 3", insert)
+	}
+
+	result, err := m.ExecuteQuery(context.Background(), "SELECT 姓名, CAST(age AS INTEGER) AS n, age / 4.0 FROM people ORDER BY rowid;")
+	if err != nil {
+		t.Fatalf("ExecuteQuery(SELECT) error = %v", err)
+	}
+	wantColumns := []Column{
+		{Name: "姓名", PhysicalName: "_1", DeclaredType: "TEXT"},
+		{Name: "n", PhysicalName: "n"},
+		{Name: "age / 4.0", PhysicalName: "age / 4.0"},
+	}
+	if !reflect.DeepEqual(result.Columns, wantColumns) {
+		t.Errorf("Columns = %+v, want %+v", result.Columns, wantColumns)
+	}
+	wantRows := [][]any{
+		{"张三", int64(30), 7.5},
+		{"李四", int64(40), 10.0},
+		{"王五", nil, nil},
+	}
+	if !reflect.DeepEqual(result.Rows, wantRows) {
+		t.Errorf("Rows = %#v, want %#v", result.Rows, wantRows)
+	}
+	if got := StorageClass(result.Rows[0][1]); got != "INTEGER" {
+		t.Errorf("StorageClass() = %s, want INTEGER", got)
+	}
+	if got := result.Table("-")[3]; !reflect.DeepEqual(got, []string{"王五", "-", "-"}) {
+		t.Errorf("Table() row = %v, want [王五 - -]", got)
+	}
+}
+
+func TestCancelInterruptsQuery(t *testing.T) {
+	m := newTestManager(t)
+	// Counts without end unless interrupted
+	const endless = "WITH RECURSIVE c(n) AS (SELECT 1 UNION ALL SELECT n + 1 FROM c) SELECT count(*) FROM c;"
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := m.ExecuteQuery(cancelled, endless); err == nil {
+		t.Error("ExecuteQuery() with a cancelled context should fail")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := m.ExecuteQuery(ctx, endless); err == nil {
+		t.Error("ExecuteQuery() should be interrupted by the deadline")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("interrupting the query took %s", elapsed)
+	}
+
+	// The connection is usable afterwards
+	if _, err := m.ExecuteQuery(context.Background(), "SELECT 1;"); err != nil {
+		t.Errorf("query after an interrupted one error = %v", err)
+	}
+}
+
+func TestQueryRows(t *testing.T) {
+	m := newTestManager(t)
+	rows, err := m.QueryRows(context.Background(), "SELECT column1 AS 名称, column2 FROM (VALUES ('a', 1), ('b', NULL), ('c', 2.5));")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"名称", "column2"}; !reflect.DeepEqual(rows.Names(), want) {
+		t.Errorf("Names() = %v, want %v", rows.Names(), want)
+	}
+
+	// Reading can stop early; the rest is not read
+	var got [][]any
+	for row, err := range rows.All() {
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, row)
+		if len(got) == 2 {
+			break
+		}
+	}
+	if want := [][]any{{"a", int64(1)}, {"b", nil}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("All() = %v, want %v", got, want)
+	}
+	if rows.Count() != 2 {
+		t.Errorf("Count() = %d, want 2", rows.Count())
+	}
+	if err := rows.Close(); err != nil {
+		t.Errorf("Close() error = %v", err)
+	}
+
+	// The connection is free again once the rows are closed
+	if _, err := m.ExecuteQuery(context.Background(), "SELECT 1;"); err != nil {
+		t.Errorf("query after Close() error = %v", err)
+	}
+	if _, err := m.QueryRows(context.Background(), "CREATE TABLE t (n);"); err == nil {
+		t.Error("QueryRows() of a statement without rows should fail")
+	}
+}
@@ -0,0 +1,179 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"iter"
+	"strconv"
+	"time"
+)
+
+// Column describes a column of a query result
+type Column struct {
+	Name         string // header shown to users, with Chinese headers restored
+	PhysicalName string // column name in SQLite
+	DeclaredType string // type in the table definition, empty for expressions
+}
+
+// Result is the outcome of a statement. Statements returning rows fill
+// Columns and Rows; other statements report RowsAffected and LastInsertID.
+type Result struct {
+	Columns []Column
+	// Rows holds the values as returned by SQLite: nil, int64, float64,
+	// string, []byte or, for columns declared as dates, time.Time
+	Rows         [][]any
+	RowsAffected int64
+	LastInsertID int64
+	Elapsed      time.Duration
+}
+
+// HasRows reports whether the statement returned rows, even if none matched
+func (r *Result) HasRows() bool {
+	return r.Columns != nil
+}
+
+// Names returns the column headers shown to users
+func (r *Result) Names() []string {
+	names := make([]string, len(r.Columns))
+	for i, c := range r.Columns {
+		names[i] = c.Name
+	}
+	return names
+}
+
+// Table returns the headers followed by the rows as text, with NULL
+// rendered as null
+func (r *Result) Table(null string) [][]string {
+	data := make([][]string, 0, len(r.Rows)+1)
+	data = append(data, r.Names())
+	for _, row := range r.Rows {
+		cells := make([]string, len(row))
+		for i, v := range row {
+			cells[i] = FormatValue(v, null)
+		}
+		data = append(data, cells)
+	}
+	return data
+}
+
+// Rows streams the result of a query row by row
+type Rows struct {
+	Columns []Column
+	rows    *sql.Rows
+	stmt    *sql.Stmt
+	start   time.Time
+	count   int
+	err     error
+}
+
+// All yields the rows with their values typed as in Result.Rows. Iteration
+// stops after the first error; the rows are closed once all are read.
+func (r *Rows) All() iter.Seq2[[]any, error] {
+	return func(yield func([]any, error) bool) {
+		for r.rows.Next() {
+			row := make([]any, len(r.Columns))
+			scanners := make([]any, len(r.Columns))
+			for i := range row {
+				scanners[i] = &row[i]
+			}
+			if err := r.rows.Scan(scanners...); err != nil {
+				r.err = err
+				yield(nil, err)
+				return
+			}
+			r.count++
+			if !yield(row, nil) {
+				return
+			}
+		}
+		if err := r.rows.Err(); err != nil {
+			r.err = err
+			yield(nil, err)
+		}
+	}
+}
+
+// collect reads the remaining rows into a Result
+func (r *Rows) collect() (*Result, error) {
+	defer r.Close()
+	result := &Result{Columns: r.Columns}
+	for row, err := range r.All() {
+		if err != nil {
+			return nil, err
+		}
+		result.Rows = append(result.Rows, row)
+	}
+	result.Elapsed = r.Elapsed()
+	return result, nil
+}
+
+// Names returns the column headers shown to users
+func (r *Rows) Names() []string {
+	return (&Result{Columns: r.Columns}).Names()
+}
+
+// Err returns the error that stopped reading the rows, if any
+func (r *Rows) Err() error {
+	return r.err
+}
+
+// Count returns the number of rows read so far
+func (r *Rows) Count() int {
+	return r.count
+}
+
+// Elapsed returns the time since the query started
+func (r *Rows) Elapsed() time.Duration {
+	return time.Since(r.start)
+}
+
+// Close stops reading and frees the database connection
+func (r *Rows) Close() error {
+	err := r.rows.Close()
+	if r.stmt != nil {
+		r.stmt.Close()
+	}
+	return err
+}
+
+// StorageClass returns the SQLite storage class of a result value: NULL,
+// INTEGER, REAL, TEXT or BLOB
+func StorageClass(v any) string {
+	switch v.(type) {
+	case nil:
+		return "NULL"
+	case int64, bool:
+		return "INTEGER"
+	case float64:
+		return "REAL"
+	case []byte:
+		return "BLOB"
+	default:
+		return "TEXT"
+	}
+}
+
+// FormatValue renders a result value as text, with NULL rendered as null
+func FormatValue(v any, null string) string {
+	switch v := v.(type) {
+	case nil:
+		return null
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		if v {
+			return "1"
+		}
+		return "0"
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,322 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"iter"
+	"strings"
+	"time"
+)
+
+// Statement is the outcome of one statement of the user's input. Statements
+// returning rows, such as SELECT, WITH, VALUES, PRAGMA or EXPLAIN, have Rows,
+// which must be read or closed before the next statement runs; the others
+// have Result.
+type Statement struct {
+	Text   string
+	Rows   *Rows
+	Result *Result
+}
+
+// SplitStatements splits SQL text into its statements at the semicolons
+// outside string literals, quoted identifiers, comments and trigger bodies.
+// Statements are returned without their semicolon; empty statements and
+// statements holding only comments are dropped.
+func SplitStatements(script string) []string {
+	statements, _ := scanStatements(script)
+	return statements
+}
+
+// Complete reports whether SQL text ends outside a string literal, quoted
+// identifier, block comment or trigger body, so that it can be run as is
+func Complete(script string) bool {
+	_, complete := scanStatements(script)
+	return complete
+}
+
+// scanStatements splits SQL text into statements and reports whether the
+// text is complete
+func scanStatements(script string) (statements []string, complete bool) {
+	start := 0
+	hasCode := false
+	var words []string   // first words of the current statement, upper-cased
+	depth, cases := 0, 0 // BEGIN ... END and CASE ... END nesting in a trigger body
+
+	for i := 0; i < len(script); {
+		c := script[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`' || c == '[':
+			end, ok := skipQuoted(script, i)
+			if !ok {
+				return appendStatement(statements, script[start:], hasCode), false
+			}
+			i, hasCode = end, true
+		case strings.HasPrefix(script[i:], "--"):
+			end := strings.IndexByte(script[i:], '\n')
+			if end < 0 {
+				i = len(script)
+			} else {
+				i += end + 1
+			}
+		case strings.HasPrefix(script[i:], "/*"):
+			end := strings.Index(script[i+2:], "*/")
+			if end < 0 {
+				return appendStatement(statements, script[start:], hasCode), false
+			}
+			i += end + 4
+		case c == ';' && depth == 0:
+			statements = appendStatement(statements, script[start:i], hasCode)
+			i++
+			start, hasCode, words, cases = i, false, nil, 0
+		case isWordByte(c):
+			end := i
+			for end < len(script) && isWordByte(script[end]) {
+				end++
+			}
+			word := strings.ToUpper(script[i:end])
+			if len(words) < 3 {
+				words = append(words, word)
+			}
+			if isTrigger(words) {
+				switch {
+				case word == "BEGIN":
+					depth++
+				case word == "CASE" && depth > 0:
+					cases++
+				case word == "END" && cases > 0:
+					cases--
+				case word == "END" && depth > 0:
+					depth--
+				}
+			}
+			i, hasCode = end, true
+		default:
+			if c != ' ' && c != '\t' && c != '\n' && c != '\r' {
+				hasCode = true
+			}
+			i++
+		}
+	}
+	return appendStatement(statements, script[start:], hasCode), depth == 0
+}
+
+// appendStatement adds a statement unless it holds only space and comments
+func appendStatement(statements []string, text string, hasCode bool) []string {
+	if !hasCode {
+		return statements
+	}
+	return append(statements, strings.TrimSpace(text))
+}
+
+// skipLiteral returns the position after the string literal, quoted
+// identifier or comment starting at i, or the end of the text if it is not
+// closed, and false if none starts at i
+func skipLiteral(script string, i int) (int, bool) {
+	switch c := script[i]; {
+	case c == '\'' || c == '"' || c == '`' || c == '[':
+		if end, ok := skipQuoted(script, i); ok {
+			return end, true
+		}
+	case strings.HasPrefix(script[i:], "--"):
+		if n := strings.IndexByte(script[i:], '\n'); n >= 0 {
+			return i + n, true
+		}
+	case strings.HasPrefix(script[i:], "/*"):
+		if n := strings.Index(script[i+2:], "*/"); n >= 0 {
+			return i + n + 4, true
+		}
+	default:
+		return i, false
+	}
+	return len(script), true
+}
+
+// skipQuoted returns the position after the string literal or quoted
+// identifier starting at i. Quotes are escaped by doubling them.
+func skipQuoted(script string, i int) (int, bool) {
+	quote := script[i]
+	if quote == '[' {
+		quote = ']'
+	}
+	for j := i + 1; ; {
+		k := strings.IndexByte(script[j:], quote)
+		if k < 0 {
+			return len(script), false
+		}
+		j += k + 1
+		if quote != ']' && j < len(script) && script[j] == quote {
+			j++
+			continue
+		}
+		return j, true
+	}
+}
+
+// isWordByte reports whether c may be part of a keyword or identifier,
+// counting the bytes of non-ASCII characters such as Chinese headers
+func isWordByte(c byte) bool {
+	return c == '_' || c == '$' || c >= 0x80 ||
+		('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9')
+}
+
+// isTrigger reports whether a statement starting with words creates a
+// trigger, whose body holds statements of its own
+func isTrigger(words []string) bool {
+	if len(words) < 2 || words[0] != "CREATE" {
+		return false
+	}
+	if words[1] == "TEMP" || words[1] == "TEMPORARY" {
+		return len(words) > 2 && words[2] == "TRIGGER"
+	}
+	return words[1] == "TRIGGER"
+}
+
+// Execute runs a single statement. Whether it returns rows is decided by
+// the prepared statement rather than its first keyword, so a CTE feeding an
+// INSERT changes the database and EXPLAIN of an INSERT returns rows.
+// Chinese headers in the statement are translated to column names and
+// search(table, 'query') to a full-text search, see ExpandSearches.
+func (m *Manager) Execute(ctx context.Context, statement string) (*Statement, error) {
+	start := time.Now()
+	query, err := m.ExpandSearches(statement)
+	if err != nil {
+		return nil, err
+	}
+	stmt, err := m.db.Load().PrepareContext(ctx, m.mapper.TranslateQuery(query))
+	if err != nil {
+		return nil, err
+	}
+
+	// Querying binds the statement without stepping it, so a statement
+	// without columns is only run by the Exec below
+	rows, err := stmt.QueryContext(ctx)
+	if err != nil {
+		stmt.Close()
+		return nil, err
+	}
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		rows.Close()
+		stmt.Close()
+		return nil, err
+	}
+	if len(columnTypes) > 0 {
+		return &Statement{Text: statement, Rows: m.newRows(rows, stmt, columnTypes, start)}, nil
+	}
+	rows.Close()
+	defer stmt.Close()
+
+	before, err := m.totalChanges(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res, err := stmt.ExecContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result := &Result{Elapsed: time.Since(start)}
+	result.LastInsertID, _ = res.LastInsertId()
+	// SQLite repeats the count of the last INSERT, UPDATE or DELETE for
+	// statements that change no rows, such as BEGIN or CREATE
+	if after, err := m.totalChanges(ctx); err == nil && after != before {
+		result.RowsAffected, _ = res.RowsAffected()
+	}
+	return &Statement{Text: statement, Result: result}, nil
+}
+
+// totalChanges returns the number of rows changed since the connection opened
+func (m *Manager) totalChanges(ctx context.Context) (int64, error) {
+	var n int64
+	err := m.db.Load().QueryRowContext(ctx, "SELECT total_changes()").Scan(&n)
+	return n, err
+}
+
+// Run runs the statements of the user's input one after the other and
+// yields each outcome, closing its rows once the consumer moves on. Running
+// stops at the first error; if the input holds several statements and began
+// a transaction that is still open, the transaction is rolled back.
+func (m *Manager) Run(ctx context.Context, input string) iter.Seq2[*Statement, error] {
+	return func(yield func(*Statement, error) bool) {
+		statements := SplitStatements(input)
+		script := len(statements) > 1
+		inTransaction := script && m.InTransaction()
+
+		for _, text := range statements {
+			st, err := m.Execute(ctx, text)
+			more := true
+			if err == nil {
+				more = yield(st, nil)
+				if st.Rows != nil {
+					st.Rows.Close()
+					err = st.Rows.Err()
+				}
+			}
+			if err != nil && script && !inTransaction && m.InTransaction() {
+				err = m.rollback(ctx, err)
+			}
+			// A consumer that stopped has seen the error of its rows
+			if err != nil && more {
+				yield(nil, err)
+			}
+			if err != nil || !more {
+				return
+			}
+		}
+	}
+}
+
+// rollback ends the transaction begun by a failed script
+func (m *Manager) rollback(ctx context.Context, cause error) error {
+	// The statement may have failed because ctx was cancelled
+	if _, err := m.db.Load().ExecContext(context.WithoutCancel(ctx), "ROLLBACK"); err != nil {
+		return fmt.Errorf("%w; rolling back the transaction failed: %v", cause, err)
+	}
+	return fmt.Errorf("%w; transaction rolled back", cause)
+}
+
+// InTransaction reports whether a transaction begun with BEGIN is open
+func (m *Manager) InTransaction() bool {
+	conn, err := m.db.Load().Conn(context.Background())
+	if err != nil {
+		return false
+	}
+	defer conn.Close()
+
+	inTransaction := false
+	conn.Raw(func(driverConn any) error {
+		if c, ok := driverConn.(interface{ AutoCommit() bool }); ok {
+			inTransaction = !c.AutoCommit()
+		}
+		return nil
+	})
+	return inTransaction
+}
+
+// begin starts the transaction of an import or index build. The database
+// has a single connection, so SQLite cannot nest it in one begun with BEGIN;
+// that has to end first.
+func (m *Manager) begin(ctx context.Context) (*sql.Tx, error) {
+	if m.InTransaction() {
+		return nil, errOpenTransaction
+	}
+	return m.db.Load().BeginTx(ctx, nil)
+}
+
+// errNoRows is returned when a statement expected to return rows does not
+var errNoRows = errors.New("statement does not return rows")
+
+// newRows wraps the rows of a statement, restoring Chinese headers
+func (m *Manager) newRows(rows *sql.Rows, stmt *sql.Stmt, columnTypes []*sql.ColumnType, start time.Time) *Rows {
+	// Restore Chinese headers by reversing the mapping
+	columns := make([]Column, len(columnTypes))
+	physical := make([]string, len(columnTypes))
+	for i, ct := range columnTypes {
+		physical[i] = ct.Name()
+	}
+	for i, name := range m.mapper.RestoreHeaders(physical) {
+		columns[i] = Column{Name: name, PhysicalName: physical[i], DeclaredType: columnTypes[i].DatabaseTypeName()}
+	}
+	return &Rows{Columns: columns, rows: rows, stmt: stmt, start: start}
+}
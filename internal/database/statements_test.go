@@ -0,0 +1,109 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		name     string
+		script   string
+		want     []string
+		complete bool
+	}{
+		{"single", "SELECT 1", []string{"SELECT 1"}, true},
+		{"several", "BEGIN; INSERT INTO t VALUES (1);COMMIT;", []string{"BEGIN", "INSERT INTO t VALUES (1)", "COMMIT"}, true},
+		{"semicolon in string", "SELECT 'a;b'; SELECT 'it''s;'", []string{"SELECT 'a;b'", "SELECT 'it''s;'"}, true},
+		{"quoted identifiers", `SELECT "a;" , [b;], ` + "`c;`", []string{`SELECT "a;" , [b;], ` + "`c;`"}, true},
+		{"comments", "-- first; still comment\nSELECT 1; /* ; */ SELECT 2;", []string{"-- first; still comment\nSELECT 1", "/* ; */ SELECT 2"}, true},
+		{"only comments", "; -- nothing\n;", nil, true},
+		{"chinese header", "SELECT 姓名 FROM t;SELECT 1", []string{"SELECT 姓名 FROM t", "SELECT 1"}, true},
+		{
+			"trigger body",
+			"CREATE TRIGGER tr AFTER INSERT ON t BEGIN UPDATE t SET n = CASE WHEN n > 0 THEN 1 ELSE 0 END; DELETE FROM u; END; SELECT 1",
+			[]string{"CREATE TRIGGER tr AFTER INSERT ON t BEGIN UPDATE t SET n = CASE WHEN n > 0 THEN 1 ELSE 0 END; DELETE FROM u; END", "SELECT 1"},
+			true,
+		},
+		{"begin transaction", "BEGIN TRANSACTION; SELECT 1", []string{"BEGIN TRANSACTION", "SELECT 1"}, true},
+		{"open string", "SELECT 'a;", []string{"SELECT 'a;"}, false},
+		{"open comment", "SELECT 1; /* note", []string{"SELECT 1"}, false},
+		{"open trigger", "CREATE TEMP TRIGGER tr AFTER INSERT ON t BEGIN DELETE FROM u;", []string{"CREATE TEMP TRIGGER tr AFTER INSERT ON t BEGIN DELETE FROM u;"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SplitStatements(tt.script); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SplitStatements(%q) = %q, want %q", tt.script, got, tt.want)
+			}
+			if got := Complete(tt.script); got != tt.complete {
+				t.Errorf("Complete(%q) = %v, want %v", tt.script, got, tt.complete)
+			}
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	m := newTestManager(t)
+	ctx := context.Background()
+	if err := m.CreateAndInsert("t", [][]string{{"n"}, {"1"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Statements are classified by their columns, not their first keyword
+	var kinds []string
+	for st, err := range m.Run(ctx, "WITH x(v) AS (VALUES (2)) INSERT INTO t SELECT v FROM x; WITH y AS (SELECT n FROM t) SELECT * FROM y; EXPLAIN DELETE FROM t") {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if st.Rows != nil {
+			kinds = append(kinds, "rows")
+		} else {
+			kinds = append(kinds, "result")
+		}
+	}
+	if want := []string{"result", "rows", "rows"}; !reflect.DeepEqual(kinds, want) {
+		t.Errorf("statement kinds = %v, want %v", kinds, want)
+	}
+
+	// A failing script rolls back the transaction it began
+	_, err := m.ExecuteQuery(ctx, "BEGIN; INSERT INTO t VALUES ('3'); INSERT INTO missing VALUES (1); COMMIT;")
+	if err == nil || !strings.Contains(err.Error(), "rolled back") {
+		t.Errorf("ExecuteQuery(failing script) error = %v, want a rollback", err)
+	}
+	if m.InTransaction() {
+		t.Error("transaction still open after the failing script")
+	}
+
+	// A transaction begun earlier stays open for the user to end
+	begin, err := m.ExecuteQuery(ctx, "BEGIN")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if begin.RowsAffected != 0 {
+		t.Errorf("BEGIN rows affected = %d, want 0", begin.RowsAffected)
+	}
+	if _, err := m.ExecuteQuery(ctx, "INSERT INTO t VALUES ('4'); INSERT INTO missing VALUES (1)"); err == nil {
+		t.Error("ExecuteQuery(failing script) should fail")
+	}
+	if !m.InTransaction() {
+		t.Error("transaction begun before the script was rolled back")
+	}
+
+	// Imports cannot nest their own transaction in the user's
+	if err := m.CreateAndInsert("u", [][]string{{"n"}, {"1"}}); !errors.Is(err, errOpenTransaction) {
+		t.Errorf("CreateAndInsert in a transaction error = %v, want %v", err, errOpenTransaction)
+	}
+	if _, err := m.CreateSearchIndex(ctx, "t", nil); !errors.Is(err, errOpenTransaction) {
+		t.Errorf("CreateSearchIndex in a transaction error = %v, want %v", err, errOpenTransaction)
+	}
+	result, err := m.ExecuteQuery(ctx, "COMMIT; SELECT group_concat(n) FROM t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := result.Table("NULL")[1][0]; got != "1,2,4" {
+		t.Errorf("rows = %s, want 1,2,4", got)
+	}
+}
@@ -0,0 +1,194 @@
+package database
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// maxCachedPatterns bounds the compiled regular expressions kept between
+// calls; a query uses one or two patterns, so the cache is simply emptied
+// when full
+const maxCachedPatterns = 100
+
+var patterns = struct {
+	sync.Mutex
+	compiled map[string]*regexp.Regexp
+}{compiled: make(map[string]*regexp.Regexp)}
+
+// compilePattern compiles a regular expression in Go's syntax, reusing the
+// result for the rows that follow
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	patterns.Lock()
+	defer patterns.Unlock()
+	if re, ok := patterns.compiled[pattern]; ok {
+		return re, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regular expression %q: %w", pattern, err)
+	}
+	if len(patterns.compiled) >= maxCachedPatterns {
+		clear(patterns.compiled)
+	}
+	patterns.compiled[pattern] = re
+	return re, nil
+}
+
+// textArguments returns the arguments as text; false if any is NULL
+func textArguments(args ...any) ([]string, bool) {
+	texts := make([]string, len(args))
+	for i, v := range args {
+		s, ok := textValue(v)
+		if !ok {
+			return nil, false
+		}
+		texts[i] = s
+	}
+	return texts, true
+}
+
+// regexpMatch implements the REGEXP operator: SQLite turns s REGEXP pattern
+// into regexp(pattern, s)
+func regexpMatch(pattern, v any) (any, error) {
+	args, ok := textArguments(pattern, v)
+	if !ok {
+		return nil, nil
+	}
+	re, err := compilePattern(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return re.MatchString(args[1]), nil
+}
+
+// regexpReplace implements regexp_replace(s, pattern, replacement), which
+// replaces every match; the replacement refers to groups as $1 or ${name}
+func regexpReplace(v, pattern, replacement any) (any, error) {
+	args, ok := textArguments(v, pattern, replacement)
+	if !ok {
+		return nil, nil
+	}
+	re, err := compilePattern(args[1])
+	if err != nil {
+		return nil, err
+	}
+	return re.ReplaceAllString(args[0], args[2]), nil
+}
+
+// regexpExtract implements regexp_extract(s, pattern [, group]), giving the
+// first match, or the given group of it, and NULL when nothing matches or
+// an argument is NULL
+func regexpExtract(v, pattern any, options ...any) (any, error) {
+	args, ok := textArguments(append([]any{v, pattern}, options...)...)
+	if !ok {
+		return nil, nil
+	}
+	re, err := compilePattern(args[1])
+	if err != nil {
+		return nil, err
+	}
+	group := int64(0)
+	if len(options) > 0 {
+		n, ok := wholeNumber(options[0])
+		if !ok {
+			return nil, fmt.Errorf("regexp_extract: group must be a whole number, got %v", options[0])
+		}
+		if n < 0 || n > int64(re.NumSubexp()) {
+			return nil, fmt.Errorf("regexp_extract: %q has no group %d", args[1], n)
+		}
+		group = n
+	}
+	match := re.FindStringSubmatchIndex(args[0])
+	if match == nil || match[2*group] < 0 {
+		return nil, nil
+	}
+	return args[0][match[2*group]:match[2*group+1]], nil
+}
+
+// splitPart implements split_part(s, delimiter, n), the nth field of s
+// counting from 1, or from the end for a negative n. A field that does not
+// exist is empty text.
+func splitPart(v, delimiter, field any) (any, error) {
+	args, ok := textArguments(v, delimiter, field)
+	if !ok {
+		return nil, nil
+	}
+	n, ok := wholeNumber(field)
+	if !ok {
+		return nil, fmt.Errorf("split_part: field number must be a whole number, got %v", field)
+	}
+	if n == 0 {
+		return nil, fmt.Errorf("split_part: field numbers start at 1")
+	}
+	fields := []string{args[0]}
+	if args[1] != "" {
+		fields = strings.Split(args[0], args[1])
+	}
+	if n < 0 {
+		n += int64(len(fields)) + 1
+	}
+	if n < 1 || n > int64(len(fields)) {
+		return "", nil
+	}
+	return fields[n-1], nil
+}
+
+// wholeNumber converts an integer argument, which may arrive as text such as
+// '2' from a CSV column, or as a real without a fraction
+func wholeNumber(v any) (int64, bool) {
+	f, ok := numericValue(v)
+	if !ok || f != math.Trunc(f) || math.Abs(f) > math.MaxInt32 {
+		return 0, false
+	}
+	return int64(f), true
+}
+
+// levenshtein implements levenshtein(a, b), the number of characters to
+// insert, delete or change to turn a into b
+func levenshtein(a, b any) any {
+	args, ok := textArguments(a, b)
+	if !ok {
+		return nil
+	}
+	return int64(editDistance([]rune(args[0]), []rune(args[1])))
+}
+
+// similarity implements similarity(a, b), from 0 for entirely different
+// text to 1 for equal text: the edit distance relative to the longer text
+func similarity(a, b any) any {
+	args, ok := textArguments(a, b)
+	if !ok {
+		return nil
+	}
+	ra, rb := []rune(args[0]), []rune(args[1])
+	longest := max(len(ra), len(rb))
+	if longest == 0 {
+		return 1.0
+	}
+	return 1 - float64(editDistance(ra, rb))/float64(longest)
+}
+
+// editDistance computes the Levenshtein distance one row at a time
+func editDistance(a, b []rune) int {
+	row := make([]int, len(b)+1)
+	for j := range row {
+		row[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		diagonal := row[0]
+		row[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			above := row[j]
+			row[j] = min(row[j]+1, row[j-1]+1, diagonal+cost)
+			diagonal = above
+		}
+	}
+	return row[len(b)]
+}
@@ -0,0 +1,119 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	sqlite3 "github.com/mattn/go-sqlite3"
+)
+
+// errOpenTransaction is returned when the workspace cannot change while a
+// transaction begun with BEGIN is open
+var errOpenTransaction = errors.New("a transaction is open, COMMIT or ROLLBACK it first")
+
+// Save copies the main database, header mappings included, to the SQLite
+// file at filePath with SQLite's online backup, replacing what the file
+// held. Attached databases are not copied.
+func (m *Manager) Save(ctx context.Context, filePath string) error {
+	if m.InTransaction() {
+		return errOpenTransaction
+	}
+
+	dest, err := sql.Open(DriverName, filePath)
+	if err != nil {
+		return err
+	}
+	defer dest.Close()
+
+	destConn, err := dest.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer destConn.Close()
+	srcConn, err := m.db.Load().Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer srcConn.Close()
+
+	return destConn.Raw(func(destDriver any) error {
+		return srcConn.Raw(func(srcDriver any) error {
+			to, ok := destDriver.(*sqlite3.SQLiteConn)
+			from, ok2 := srcDriver.(*sqlite3.SQLiteConn)
+			if !ok || !ok2 {
+				return errors.New("online backup needs SQLite connections")
+			}
+			backup, err := to.Backup("main", from, "main")
+			if err != nil {
+				return err
+			}
+			// Copy every page in one step; the source is not changed meanwhile
+			if _, err := backup.Step(-1); err != nil {
+				backup.Finish()
+				return err
+			}
+			return backup.Finish()
+		})
+	})
+}
+
+// Open switches to the SQLite database at filePath, creating it if it does
+// not exist, and restores the header mappings, functions and macros saved
+// in it. The previous database is closed, so an in-memory workspace is lost
+// unless saved and attached databases are detached. Opening a database
+// does not write to it.
+func (m *Manager) Open(filePath string) error {
+	if m.InTransaction() {
+		return errOpenTransaction
+	}
+
+	db, err := sql.Open(DriverName, filePath)
+	if err != nil {
+		return err
+	}
+	db.SetMaxOpenConns(1)
+
+	// Everything that can fail is done before switching, so that a file
+	// that is not a database leaves the current workspace in place
+	ctx := context.Background()
+	mappings, err := readMappings(db, "main")
+	if err != nil {
+		db.Close()
+		return err
+	}
+	functions, macros, err := readDefinitions(ctx, db)
+	if err != nil {
+		db.Close()
+		return err
+	}
+	for _, f := range functions {
+		if err := register(ctx, db, f); err != nil {
+			db.Close()
+			return err
+		}
+	}
+
+	previous := m.db.Swap(db)
+	m.mapper.Clear()
+	for tableName, tableMappings := range mappings {
+		m.mapper.SetTableMappings(tableName, tableMappings)
+	}
+	m.setDefinitions(functions, macros)
+	return previous.Close()
+}
+
+// Tables returns the number of tables in the main database, not counting
+// the bookkeeping tables
+func (m *Manager) Tables() (int, error) {
+	var n int
+	query := fmt.Sprintf("SELECT count(*) FROM sqlite_master WHERE type='table' AND substr(name, 1, %d) != '%s';", len(CatalogPrefix), CatalogPrefix)
+	err := m.db.Load().QueryRow(query).Scan(&n)
+	return n, err
+}
+
+// Close closes the database
+func (m *Manager) Close() error {
+	return m.db.Load().Close()
+}
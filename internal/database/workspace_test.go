@@ -0,0 +1,66 @@
+package database
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSaveOpenAttach(t *testing.T) {
+	ctx := context.Background()
+	m := newTestManager(t)
+	if err := m.CreateAndInsert("people", [][]string{{"姓名", "age"}, {"张三", "30"}}); err != nil {
+		t.Fatal(err)
+	}
+	saved := filepath.Join(t.TempDir(), "work.db")
+	if err := m.Save(ctx, saved); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	// A fresh workspace is empty until the saved file is opened
+	other := newTestManager(t)
+	if err := other.Open(filepath.Join(t.TempDir(), "new.db")); err != nil {
+		t.Fatalf("Open(new) error = %v", err)
+	}
+	if n, err := other.Tables(); err != nil || n != 0 {
+		t.Errorf("Tables() = %d, %v, want 0", n, err)
+	}
+
+	// Opening a database made elsewhere leaves it without bookkeeping tables
+	var n int
+	if err := other.db.Load().QueryRow("SELECT count(*) FROM sqlite_master;").Scan(&n); err != nil || n != 0 {
+		t.Errorf("tables written by Open() = %d, %v, want 0", n, err)
+	}
+	if err := other.Open(saved); err != nil {
+		t.Fatalf("Open(saved) error = %v", err)
+	}
+	result, err := other.ExecuteQuery(ctx, "SELECT 姓名 FROM people;")
+	if err != nil {
+		t.Fatalf("query after Open() error = %v", err)
+	}
+	if got := result.Table("NULL"); got[0][0] != "姓名" || got[1][0] != "张三" {
+		t.Errorf("result after Open() = %v, want the saved table with its Chinese header", got)
+	}
+
+	// Attached files bring their mappings under schema.table
+	attaching := newTestManager(t)
+	if err := attaching.AttachDatabase(saved, "archive"); err != nil {
+		t.Fatalf("AttachDatabase() error = %v", err)
+	}
+	if got, ok := attaching.GetMapper().GetColumnName("archive.people", "姓名"); !ok || got != "_1" {
+		t.Errorf("attached mapping = %q, %v, want _1", got, ok)
+	}
+
+	// The workspace stays in place when the file is not a database
+	notDB := filepath.Join(t.TempDir(), "notes.db")
+	if err := os.WriteFile(notDB, []byte("not a database, just some notes"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := other.Open(notDB); err == nil {
+		t.Error("Open(not a database) should fail")
+	}
+	if _, err := other.ExecuteQuery(ctx, "SELECT count(*) FROM people;"); err != nil {
+		t.Errorf("workspace lost after a failed Open(): %v", err)
+	}
+}
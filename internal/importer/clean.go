@@ -0,0 +1,252 @@
+package importer
+
+import (
+	"fmt"
+	"iter"
+	"maps"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+
+	"csvsql/internal/zh"
+	"csvsql/pkg/utils"
+)
+
+// Transform cleans the value of a single cell. Values a transform does not
+// recognise are returned unchanged.
+type Transform func(value string) string
+
+// Transforms holds the cleaning transforms available in clean specs. The
+// date transforms listed here use the default zh.DateParser; the processor
+// replaces them with ones using the configured formats and time zone.
+var Transforms = map[string]Transform{
+	"trim":     strings.TrimSpace,
+	"nfkc":     norm.NFKC.String,
+	"number":   cleanNumber,
+	"currency": cleanCurrency,
+	"percent":  cleanPercent,
+	"bool":     cleanBool,
+}
+
+func init() {
+	maps.Copy(Transforms, dateTransforms(&zh.DateParser{}))
+}
+
+// TransformNames returns the names of the available transforms
+func TransformNames() []string {
+	names := make([]string, 0, len(Transforms))
+	for name := range Transforms {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// CleanRule applies transforms, in order, to a column. The column "*"
+// matches every column; its transforms run before column specific ones.
+type CleanRule struct {
+	Column     string
+	Transforms []string
+}
+
+// ParseCleanSpec parses a clean spec such as "*:trim,nfkc;金额:currency".
+// Rules may be separated by semicolons or newlines; blank lines and lines
+// starting with '#' are ignored.
+func ParseCleanSpec(spec string) ([]CleanRule, error) {
+	var rules []CleanRule
+	fields := strings.FieldsFunc(spec, func(r rune) bool { return r == ';' || r == '\n' })
+	for _, field := range fields {
+		field = strings.TrimSpace(field)
+		if field == "" || strings.HasPrefix(field, "#") {
+			continue
+		}
+
+		sep := strings.LastIndex(field, ":")
+		if sep <= 0 {
+			return nil, fmt.Errorf("invalid clean rule %q, expected column:transform,...", field)
+		}
+		rule := CleanRule{Column: strings.TrimSpace(field[:sep])}
+		for _, name := range strings.Split(field[sep+1:], ",") {
+			name = strings.ToLower(strings.TrimSpace(name))
+			if _, ok := Transforms[name]; !ok {
+				return nil, fmt.Errorf("unknown transform %q in %q, available: %s", name, field, strings.Join(TransformNames(), ", "))
+			}
+			rule.Transforms = append(rule.Transforms, name)
+		}
+		rules = append(rules, rule)
+	}
+
+	if len(rules) == 0 {
+		return nil, fmt.Errorf("empty clean spec")
+	}
+	return rules, nil
+}
+
+// LoadCleanSpec parses a clean spec given inline or as the path of a spec file
+func LoadCleanSpec(specOrPath string) ([]CleanRule, error) {
+	if info, err := os.Stat(specOrPath); err == nil && !info.IsDir() {
+		content, err := os.ReadFile(specOrPath)
+		if err != nil {
+			return nil, err
+		}
+		return ParseCleanSpec(string(content))
+	}
+	return ParseCleanSpec(specOrPath)
+}
+
+// cleanRecords applies the rules to the data rows of records. Rules are
+// matched to the header by its text or its sanitized column name, ignoring
+// case as SQLite does; rules for columns the table lacks are ignored.
+func cleanRecords(records iter.Seq2[[]string, error], rules []CleanRule, transforms map[string]Transform) iter.Seq2[[]string, error] {
+	return func(yield func([]string, error) bool) {
+		var columns [][]Transform
+		for record, err := range records {
+			switch {
+			case err != nil:
+			case columns == nil:
+				columns = columnTransforms(record, rules, transforms)
+			default:
+				for i, column := range columns[:min(len(columns), len(record))] {
+					for _, transform := range column {
+						record[i] = transform(record[i])
+					}
+				}
+			}
+			if !yield(record, err) {
+				return
+			}
+		}
+	}
+}
+
+// columnTransforms resolves the transforms of every column of a header
+func columnTransforms(header []string, rules []CleanRule, transforms map[string]Transform) [][]Transform {
+	columns := make([][]Transform, len(header))
+	for _, wildcard := range []bool{true, false} {
+		for _, rule := range rules {
+			if (rule.Column == "*") != wildcard {
+				continue
+			}
+			for i, h := range header {
+				h = strings.TrimSpace(h)
+				if wildcard || strings.EqualFold(rule.Column, h) || strings.EqualFold(rule.Column, utils.SanitizeColumnName(h)) {
+					for _, name := range rule.Transforms {
+						columns[i] = append(columns[i], transforms[name])
+					}
+				}
+			}
+		}
+	}
+	return columns
+}
+
+// currencyMarks are stripped from amounts by the currency transform
+var currencyMarks = []string{"人民币", "RMB", "CNY", "¥", "￥", "$", "元"}
+
+// groupedNumber matches a number with thousands separators, e.g. "1,234.5"
+var groupedNumber = regexp.MustCompile(`^[+-]?\d{1,3}([,，]\d{3})+(\.\d+)?$`)
+
+// cleanNumber removes thousands separators from a number, e.g. "1,234.5"
+func cleanNumber(value string) string {
+	number := strings.TrimSpace(value)
+	if groupedNumber.MatchString(number) {
+		return strings.NewReplacer(",", "", "，", "").Replace(number)
+	}
+	if isDecimal(number) {
+		return number
+	}
+	return value
+}
+
+// cleanCurrency removes currency symbols and suffixes and thousands
+// separators from an amount, e.g. "¥1,234.00" or "1,234元"
+func cleanCurrency(value string) string {
+	amount := strings.TrimSpace(value)
+	for _, mark := range currencyMarks {
+		amount = strings.TrimSpace(strings.TrimPrefix(amount, mark))
+		amount = strings.TrimSpace(strings.TrimSuffix(amount, mark))
+	}
+	if cleaned := cleanNumber(amount); isDecimal(cleaned) {
+		return cleaned
+	}
+	return value
+}
+
+// cleanPercent turns a percentage into a fraction, e.g. "12.5%" into "0.125"
+func cleanPercent(value string) string {
+	trimmed := strings.TrimSpace(value)
+	number, ok := strings.CutSuffix(trimmed, "%")
+	if !ok {
+		number, ok = strings.CutSuffix(trimmed, "％")
+	}
+	number = strings.TrimSpace(number)
+	if !ok || !isDecimal(number) {
+		return value
+	}
+	return shiftDecimal(number, 2)
+}
+
+// booleans maps the spellings understood by the bool transform to 1 and 0
+var booleans = map[string]string{
+	"是": "1", "否": "0",
+	"对": "1", "错": "0",
+	"真": "1", "假": "0",
+	"yes": "1", "no": "0",
+	"y": "1", "n": "0",
+	"true": "1", "false": "0",
+}
+
+// cleanBool turns yes/no answers such as 是/否 into 1 and 0
+func cleanBool(value string) string {
+	if b, ok := booleans[strings.ToLower(strings.TrimSpace(value))]; ok {
+		return b
+	}
+	return value
+}
+
+// isDecimal reports whether s is a plain decimal number such as "-12.50"
+func isDecimal(s string) bool {
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "-"), "+")
+	digits, dots := 0, 0
+	for _, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+			digits++
+		case r == '.':
+			dots++
+		default:
+			return false
+		}
+	}
+	return digits > 0 && dots <= 1
+}
+
+// shiftDecimal divides a decimal number by 10^places by moving its decimal
+// point, avoiding the rounding errors of floating point division
+func shiftDecimal(s string, places int) string {
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign = "-"
+	}
+	s = strings.TrimLeft(s, "+-")
+
+	intPart, fracPart, _ := strings.Cut(s, ".")
+	if len(intPart) < places+1 {
+		intPart = strings.Repeat("0", places+1-len(intPart)) + intPart
+	}
+	point := len(intPart) - places
+	intPart, fracPart = intPart[:point], intPart[point:]+fracPart
+
+	intPart = strings.TrimLeft(intPart, "0")
+	if intPart == "" {
+		intPart = "0"
+	}
+	fracPart = strings.TrimRight(fracPart, "0")
+	if fracPart == "" {
+		return sign + intPart
+	}
+	return sign + intPart + "." + fracPart
+}
@@ -0,0 +1,73 @@
+package importer
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTransforms(t *testing.T) {
+	tests := []struct {
+		transform string
+		in        string
+		want      string
+	}{
+		{"trim", "　 张三 ", "张三"},
+		{"nfkc", "１２３，ＡＢＣ", "123,ABC"},
+		{"number", "1,234,567.89", "1234567.89"},
+		{"number", "1，234", "1234"},
+		{"number", "12,34", "12,34"},
+		{"currency", "¥1,234.50", "1234.50"},
+		{"currency", "1,200元", "1200"},
+		{"currency", "RMB 88", "88"},
+		{"currency", "面议", "面议"},
+		{"percent", "12.5%", "0.125"},
+		{"percent", "33.3％", "0.333"},
+		{"percent", "-5%", "-0.05"},
+		{"percent", "150%", "1.5"},
+		{"percent", "n/a", "n/a"},
+		{"bool", "是", "1"},
+		{"bool", "否", "0"},
+		{"bool", " Yes ", "1"},
+		{"bool", "未知", "未知"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.transform+" "+tt.in, func(t *testing.T) {
+			if got := Transforms[tt.transform](tt.in); got != tt.want {
+				t.Errorf("%s(%q) = %q, want %q", tt.transform, tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCleanRecords(t *testing.T) {
+	rules, err := ParseCleanSpec("*:trim; 金额:nfkc,currency\n# comment\nrate:percent")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := [][]string{
+		{"name", "金额", "Rate"},
+		{" a ", " ￥１，２００ ", " 8% "},
+		{"b", "3元", "x"},
+	}
+	var got [][]string
+	for record, err := range cleanRecords(sliceRecords(data), rules, Transforms) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, record)
+	}
+
+	want := [][]string{
+		{"name", "金额", "Rate"},
+		{"a", "1200", "0.08"},
+		{"b", "3", "x"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("cleanRecords() = %v, want %v", got, want)
+	}
+
+	if _, err := ParseCleanSpec("金额:upper"); err == nil {
+		t.Error("ParseCleanSpec() should reject unknown transforms")
+	}
+}
@@ -1,18 +1,174 @@
 package importer
 
 import (
+	"bytes"
 	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
 	"os"
+	"strings"
+
+	"csvsql/pkg/format"
 )
 
+// csvFormat reads comma-separated files
+type csvFormat struct{}
+
+func (csvFormat) Name() string            { return "csv" }
+func (csvFormat) Extensions() []string    { return []string{".csv"} }
+func (csvFormat) Detect(head []byte) bool { return false }
+
+func (csvFormat) Tables(filePath string, opts format.Options) ([]*Table, error) {
+	if opts.Lenient {
+		return []*Table{openCSVLenient(filePath)}, nil
+	}
+	return []*Table{openCSV(filePath)}, nil
+}
+
 // ReadCSV reads all records from a CSV file
 func ReadCSV(filePath string) ([][]string, error) {
-	file, err := os.Open(filePath)
+	return collectRecords(openCSV(filePath))
+}
+
+// ReadCSVLenient reads a CSV file while tolerating malformed input.
+// Bare quotes are kept as text and rows are padded or truncated to the width
+// of the header. Every row that was not loaded verbatim is reported as a
+// reject. No row is dropped, so no reject is marked Skipped.
+func ReadCSVLenient(filePath string) ([][]string, []format.Reject, error) {
+	t := openCSVLenient(filePath)
+	data, err := collectRecords(t)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	return data, t.Meta.Rejects, nil
+}
+
+// openCSV streams the records of a CSV file, failing on the first malformed row
+func openCSV(filePath string) *Table {
+	t := &Table{Meta: Metadata{Format: "csv", Source: filePath}}
+	t.Records = func(yield func([]string, error) bool) {
+		file, err := os.Open(filePath)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		defer file.Close()
+
+		reader := csv.NewReader(file)
+		for {
+			record, err := reader.Read()
+			if err == io.EOF {
+				return
+			}
+			if !yield(record, err) || err != nil {
+				return
+			}
+		}
+	}
+	return t
+}
+
+// openCSVLenient streams the records of a CSV file, repairing malformed
+// rows and recording them in the table's rejects
+func openCSVLenient(filePath string) *Table {
+	t := &Table{Meta: Metadata{Format: "csv", Source: filePath, Detail: "lenient"}}
+	t.Records = func(yield func([]string, error) bool) {
+		file, err := os.Open(filePath)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		defer file.Close()
+		t.Meta.Rejects = nil
+
+		input := &rawInput{r: file}
+		reader := csv.NewReader(input)
+		reader.LazyQuotes = true
+		reader.FieldsPerRecord = -1
+
+		width := -1
+		var offset int64
+		for {
+			record, err := reader.Read()
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			raw := input.next(reader.InputOffset() - offset)
+			offset = reader.InputOffset()
+
+			line, _ := reader.FieldPos(0)
+
+			// LazyQuotes keeps bare quotes as text; a strict reader tells
+			// whether the row needed that
+			var reasons []string
+			if err := strictQuotes(raw); err != nil {
+				reasons = append(reasons, "repaired: "+err.Error())
+			}
+
+			switch {
+			case width < 0:
+				// The header decides how many columns every following row should have
+				width = len(record)
+			case len(record) < width:
+				reasons = append(reasons, fmt.Sprintf("padded: expected %d fields, got %d", width, len(record)))
+				record = append(record, make([]string, width-len(record))...)
+			case len(record) > width:
+				reasons = append(reasons, fmt.Sprintf("truncated: expected %d fields, got %d", width, len(record)))
+				record = record[:width]
+			}
+			if len(reasons) > 0 {
+				t.Meta.Rejects = append(t.Meta.Rejects, format.Reject{
+					Line:   line,
+					Raw:    strings.TrimRight(string(raw), "\r\n"),
+					Reason: strings.Join(reasons, "; "),
+				})
+			}
+
+			if !yield(record, nil) {
+				return
+			}
+		}
 	}
-	defer file.Close()
+	return t
+}
 
-	reader := csv.NewReader(file)
-	return reader.ReadAll()
+// rawInput keeps the bytes read from r that the CSV reader, which reads
+// ahead into its buffer, has not yet returned as records
+type rawInput struct {
+	r       io.Reader
+	pending []byte
+}
+
+func (in *rawInput) Read(p []byte) (int, error) {
+	n, err := in.r.Read(p)
+	in.pending = append(in.pending, p[:n]...)
+	return n, err
+}
+
+// next returns the n bytes that follow those already returned
+func (in *rawInput) next(n int64) []byte {
+	raw := in.pending[:n:n]
+	in.pending = in.pending[n:]
+	return raw
+}
+
+// strictQuotes returns the quoting error a strict reader finds in the text
+// of one record, or nil
+func strictQuotes(raw []byte) error {
+	if bytes.IndexByte(raw, '"') < 0 {
+		return nil
+	}
+	reader := csv.NewReader(bytes.NewReader(raw))
+	reader.FieldsPerRecord = -1
+	_, err := reader.Read()
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) && (parseErr.Err == csv.ErrBareQuote || parseErr.Err == csv.ErrQuote) {
+		return parseErr.Err
+	}
+	return nil
 }
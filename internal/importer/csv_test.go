@@ -0,0 +1,85 @@
+package importer
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"csvsql/pkg/format"
+)
+
+func writeTempFile(t *testing.T, name, content string) string {
+	t.Helper()
+	filePath := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(filePath, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return filePath
+}
+
+func TestReadCSVLenient(t *testing.T) {
+	content := "id,name,note\n1,a\"b,x\n2,only\n3,c,d,e\n4,\"ok\",fine\n"
+	filePath := writeTempFile(t, "ragged.csv", content)
+
+	if _, err := ReadCSV(filePath); err == nil {
+		t.Fatalf("ReadCSV() expected an error in strict mode")
+	}
+
+	data, rejects, err := ReadCSVLenient(filePath)
+	if err != nil {
+		t.Fatalf("ReadCSVLenient() error = %v", err)
+	}
+
+	want := [][]string{
+		{"id", "name", "note"},
+		{"1", "a\"b", "x"},
+		{"2", "only", ""},
+		{"3", "c", "d"},
+		{"4", "ok", "fine"},
+	}
+	if !reflect.DeepEqual(data, want) {
+		t.Errorf("ReadCSVLenient() data = %v, want %v", data, want)
+	}
+
+	wantRejects := []format.Reject{
+		{Line: 2, Raw: "1,a\"b,x", Reason: "repaired: bare \" in non-quoted-field"},
+		{Line: 3, Raw: "2,only", Reason: "padded: expected 3 fields, got 2"},
+		{Line: 4, Raw: "3,c,d,e", Reason: "truncated: expected 3 fields, got 4"},
+	}
+	if !reflect.DeepEqual(rejects, wantRejects) {
+		t.Errorf("ReadCSVLenient() rejects = %+v, want %+v", rejects, wantRejects)
+	}
+
+	// Rows spanning lines are reported whole, with every reason
+	filePath = writeTempFile(t, "multiline.csv", "a,b\n\"x\ny\",\"q\"z\",extra\n\"open,1\n")
+	data, rejects, err = ReadCSVLenient(filePath)
+	if err != nil {
+		t.Fatalf("ReadCSVLenient() error = %v", err)
+	}
+	if want := [][]string{{"a", "b"}, {"x\ny", "q\"z"}, {"open,1\n", ""}}; !reflect.DeepEqual(data, want) {
+		t.Errorf("ReadCSVLenient() data = %q, want %q", data, want)
+	}
+	wantRejects = []format.Reject{
+		{Line: 2, Raw: "\"x\ny\",\"q\"z\",extra", Reason: "repaired: extraneous or missing \" in quoted-field; truncated: expected 2 fields, got 3"},
+		{Line: 4, Raw: "\"open,1", Reason: "repaired: extraneous or missing \" in quoted-field; padded: expected 2 fields, got 1"},
+	}
+	if !reflect.DeepEqual(rejects, wantRejects) {
+		t.Errorf("ReadCSVLenient() rejects = %+v, want %+v", rejects, wantRejects)
+	}
+
+	// Rows far past the reader's buffer keep their own raw text
+	filePath = writeTempFile(t, "long.csv", "a,b\n"+strings.Repeat("1,2\n", 5000)+"3\n4,5\n")
+	data, rejects, err = ReadCSVLenient(filePath)
+	if err != nil {
+		t.Fatalf("ReadCSVLenient() error = %v", err)
+	}
+	if len(data) != 5003 {
+		t.Errorf("ReadCSVLenient() read %d records, want 5003", len(data))
+	}
+	wantRejects = []format.Reject{{Line: 5002, Raw: "3", Reason: "padded: expected 2 fields, got 1"}}
+	if !reflect.DeepEqual(rejects, wantRejects) {
+		t.Errorf("ReadCSVLenient() rejects = %+v, want %+v", rejects, wantRejects)
+	}
+}
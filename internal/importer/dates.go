@@ -0,0 +1,119 @@
+package importer
+
+import (
+	"iter"
+	"strings"
+
+	"csvsql/internal/zh"
+)
+
+// dateSampleRows is the number of data rows inspected to recognise date columns
+const dateSampleRows = 100
+
+// dateTransforms returns the date transforms using parser
+func dateTransforms(parser *zh.DateParser) map[string]Transform {
+	return map[string]Transform{
+		"date": func(value string) string {
+			if iso, ok := parser.Parse(value, false); ok {
+				return iso
+			}
+			return value
+		},
+		"excel-date": func(value string) string {
+			if iso, ok := parser.Parse(value, true); ok {
+				return iso
+			}
+			return value
+		},
+	}
+}
+
+// detectDates converts the columns whose values in the first data rows are
+// all dates, looking ahead at up to dateSampleRows rows. Empty cells do not
+// count, and Excel serial numbers are not recognised.
+func detectDates(records iter.Seq2[[]string, error], parser *zh.DateParser) iter.Seq2[[]string, error] {
+	return func(yield func([]string, error) bool) {
+		next, stop := iter.Pull2(records)
+		defer stop()
+
+		var sample [][]string
+		var sampleErr error
+		for len(sample) <= dateSampleRows {
+			record, err, ok := next()
+			if !ok {
+				break
+			}
+			if err != nil {
+				sampleErr = err
+				break
+			}
+			sample = append(sample, record)
+		}
+		if len(sample) == 0 {
+			if sampleErr != nil {
+				yield(nil, sampleErr)
+			}
+			return
+		}
+
+		columns := dateColumns(sample, parser)
+		convert := func(record []string) []string {
+			for _, i := range columns {
+				if i < len(record) {
+					if iso, ok := parser.Parse(record[i], false); ok {
+						record[i] = iso
+					}
+				}
+			}
+			return record
+		}
+
+		if !yield(sample[0], nil) {
+			return
+		}
+		for _, record := range sample[1:] {
+			if !yield(convert(record), nil) {
+				return
+			}
+		}
+		if sampleErr != nil {
+			yield(nil, sampleErr)
+			return
+		}
+		for {
+			record, err, ok := next()
+			if !ok {
+				return
+			}
+			if err == nil {
+				record = convert(record)
+			}
+			if !yield(record, err) || err != nil {
+				return
+			}
+		}
+	}
+}
+
+// dateColumns returns the positions of the columns holding only dates in
+// the data rows of a sample, whose first record is the header
+func dateColumns(sample [][]string, parser *zh.DateParser) []int {
+	var columns []int
+	for i := range sample[0] {
+		dates := 0
+		for _, record := range sample[1:] {
+			if i >= len(record) || strings.TrimSpace(record[i]) == "" {
+				continue
+			}
+			if _, ok := parser.Parse(record[i], false); !ok {
+				dates = -1
+				break
+			}
+			dates++
+		}
+		if dates > 0 {
+			columns = append(columns, i)
+		}
+	}
+	return columns
+}
@@ -0,0 +1,34 @@
+package importer
+
+import (
+	"reflect"
+	"testing"
+
+	"csvsql/internal/zh"
+)
+
+func TestDetectDates(t *testing.T) {
+	data := [][]string{
+		{"id", "下单日期", "备注"},
+		{"1", "2024年3月5日", "2024年3月5日"},
+		{"2", "", "n/a"},
+		{"3", "24-03-07", "x"},
+	}
+	var got [][]string
+	for record, err := range detectDates(sliceRecords(data), &zh.DateParser{}) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, record)
+	}
+
+	want := [][]string{
+		{"id", "下单日期", "备注"},
+		{"1", "2024-03-05", "2024年3月5日"},
+		{"2", "", "n/a"},
+		{"3", "2024-03-07", "x"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("detectDates() = %v, want %v", got, want)
+	}
+}
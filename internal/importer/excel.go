@@ -3,9 +3,22 @@ package importer
 import (
 	"fmt"
 
+	"csvsql/pkg/format"
+
 	"github.com/xuri/excelize/v2"
 )
 
+// xlsxFormat reads the first sheet of Excel workbooks
+type xlsxFormat struct{}
+
+func (xlsxFormat) Name() string            { return "xlsx" }
+func (xlsxFormat) Extensions() []string    { return []string{".xlsx"} }
+func (xlsxFormat) Detect(head []byte) bool { return false }
+
+func (xlsxFormat) Tables(filePath string, opts format.Options) ([]*Table, error) {
+	return []*Table{openXLSX(filePath)}, nil
+}
+
 // ReadXLSX reads all records from the first sheet of an Excel file
 func ReadXLSX(filePath string) ([][]string, error) {
 	f, err := excelize.OpenFile(filePath)
@@ -21,3 +34,42 @@ func ReadXLSX(filePath string) ([][]string, error) {
 	// Read from the first sheet
 	return f.GetRows(sheets[0])
 }
+
+// openXLSX streams the rows of the first sheet of an Excel file
+func openXLSX(filePath string) *Table {
+	t := &Table{Meta: Metadata{Format: "xlsx", Source: filePath}}
+	t.Records = func(yield func([]string, error) bool) {
+		f, err := excelize.OpenFile(filePath)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		defer f.Close()
+
+		sheets := f.GetSheetList()
+		if len(sheets) == 0 {
+			yield(nil, fmt.Errorf("no sheets found in excel file"))
+			return
+		}
+		// Read from the first sheet
+		t.Meta.Detail = sheets[0]
+
+		rows, err := f.Rows(sheets[0])
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			columns, err := rows.Columns()
+			if !yield(columns, err) || err != nil {
+				return
+			}
+		}
+		if err := rows.Error(); err != nil {
+			yield(nil, err)
+		}
+	}
+	return t
+}
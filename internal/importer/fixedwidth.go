@@ -0,0 +1,159 @@
+package importer
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"csvsql/pkg/format"
+	"csvsql/pkg/utils"
+)
+
+// fixedWidthFormat reads fixed-width text files using the configured column spec
+type fixedWidthFormat struct{}
+
+func (fixedWidthFormat) Name() string            { return "fixed-width" }
+func (fixedWidthFormat) Extensions() []string    { return []string{".txt", ".dat", ".prn", ".fwf"} }
+func (fixedWidthFormat) Detect(head []byte) bool { return false }
+
+// ExtensionsFor leaves .txt files, which are often not fixed-width, to other
+// readers unless a column spec is given
+func (f fixedWidthFormat) ExtensionsFor(opts format.Options) []string {
+	if opts.FixedSpec == "" {
+		return []string{".dat", ".prn", ".fwf"}
+	}
+	return f.Extensions()
+}
+
+func (fixedWidthFormat) Tables(filePath string, opts format.Options) ([]*Table, error) {
+	if opts.FixedSpec == "" {
+		return nil, fmt.Errorf("fixed-width file %s requires a column spec (--fixed-spec)", filePath)
+	}
+	columns, err := LoadFixedWidthSpec(opts.FixedSpec)
+	if err != nil {
+		return nil, err
+	}
+	return []*Table{openFixedWidth(filePath, columns)}, nil
+}
+
+// FixedWidthColumn describes one field of a fixed-width record.
+// Start and End are 1-based, inclusive display columns, so a double-width
+// CJK character counts as two columns.
+type FixedWidthColumn struct {
+	Name  string
+	Start int
+	End   int
+}
+
+// ParseFixedWidthSpec parses a column spec such as "name:1-10,amount:11-20".
+// Columns may be separated by commas or newlines; blank lines and lines
+// starting with '#' are ignored.
+func ParseFixedWidthSpec(spec string) ([]FixedWidthColumn, error) {
+	var columns []FixedWidthColumn
+	fields := strings.FieldsFunc(spec, func(r rune) bool { return r == ',' || r == '\n' })
+	for _, field := range fields {
+		field = strings.TrimSpace(field)
+		if field == "" || strings.HasPrefix(field, "#") {
+			continue
+		}
+
+		sep := strings.LastIndex(field, ":")
+		if sep <= 0 {
+			return nil, fmt.Errorf("invalid column spec %q, expected name:start-end", field)
+		}
+		name := strings.TrimSpace(field[:sep])
+		bounds := strings.SplitN(field[sep+1:], "-", 2)
+		if len(bounds) != 2 {
+			return nil, fmt.Errorf("invalid column range in %q, expected start-end", field)
+		}
+		start, err := strconv.Atoi(strings.TrimSpace(bounds[0]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid start column in %q: %v", field, err)
+		}
+		end, err := strconv.Atoi(strings.TrimSpace(bounds[1]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid end column in %q: %v", field, err)
+		}
+		if start < 1 || end < start {
+			return nil, fmt.Errorf("invalid column range in %q", field)
+		}
+
+		columns = append(columns, FixedWidthColumn{Name: name, Start: start, End: end})
+	}
+
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("empty fixed-width column spec")
+	}
+	return columns, nil
+}
+
+// LoadFixedWidthSpec parses a column spec given inline or as the path of a spec file
+func LoadFixedWidthSpec(specOrPath string) ([]FixedWidthColumn, error) {
+	if info, err := os.Stat(specOrPath); err == nil && !info.IsDir() {
+		content, err := os.ReadFile(specOrPath)
+		if err != nil {
+			return nil, err
+		}
+		return ParseFixedWidthSpec(string(content))
+	}
+	return ParseFixedWidthSpec(specOrPath)
+}
+
+// ReadFixedWidth reads all records from a fixed-width text file.
+// The first returned row holds the column names from the spec.
+func ReadFixedWidth(filePath string, columns []FixedWidthColumn) ([][]string, error) {
+	return collectRecords(openFixedWidth(filePath, columns))
+}
+
+// openFixedWidth streams the records of a fixed-width text file
+func openFixedWidth(filePath string, columns []FixedWidthColumn) *Table {
+	t := &Table{Meta: Metadata{Format: "fixed-width", Source: filePath}}
+	t.Records = func(yield func([]string, error) bool) {
+		headers := make([]string, len(columns))
+		for i, c := range columns {
+			headers[i] = c.Name
+		}
+		if !yield(headers, nil) {
+			return
+		}
+
+		first := true
+		err := scanLines(filePath, func(lineNo int, line string) bool {
+			if first {
+				line = strings.TrimPrefix(line, "\uFEFF")
+				first = false
+			}
+			if strings.TrimSpace(line) == "" {
+				return true
+			}
+			return yield(splitFixedWidth(line, columns), nil)
+		})
+		if err != nil {
+			yield(nil, err)
+		}
+	}
+	return t
+}
+
+// splitFixedWidth cuts a line into fields by display column. A character
+// belongs to the field in which its first column falls.
+func splitFixedWidth(line string, columns []FixedWidthColumn) []string {
+	fields := make([]strings.Builder, len(columns))
+	pos := 1
+	for _, r := range line {
+		for i, c := range columns {
+			if pos >= c.Start && pos <= c.End {
+				fields[i].WriteRune(r)
+				break
+			}
+		}
+		pos += utils.RuneWidth(r)
+	}
+
+	record := make([]string, len(columns))
+	for i := range fields {
+		record[i] = strings.Trim(fields[i].String(), " \t\u3000")
+	}
+	return record
+}
@@ -0,0 +1,52 @@
+package importer
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseFixedWidthSpec(t *testing.T) {
+	columns, err := ParseFixedWidthSpec("日期:1-10, 户名:11-20\n# comment\namount:21-30")
+	if err != nil {
+		t.Fatalf("ParseFixedWidthSpec() error = %v", err)
+	}
+	want := []FixedWidthColumn{
+		{Name: "日期", Start: 1, End: 10},
+		{Name: "户名", Start: 11, End: 20},
+		{Name: "amount", Start: 21, End: 30},
+	}
+	if !reflect.DeepEqual(columns, want) {
+		t.Errorf("ParseFixedWidthSpec() = %v, want %v", columns, want)
+	}
+
+	for _, spec := range []string{"", "name", "name:5", "name:a-b", "name:10-5", "name:0-3"} {
+		if _, err := ParseFixedWidthSpec(spec); err == nil {
+			t.Errorf("ParseFixedWidthSpec(%q) expected an error", spec)
+		}
+	}
+}
+
+func TestReadFixedWidth(t *testing.T) {
+	// 张三 occupies four display columns, just like "abcd"
+	content := "2024-03-05张三      100.00\n2024-03-06abcd      -20.50\n\n"
+	filePath := writeTempFile(t, "statement.txt", content)
+
+	columns := []FixedWidthColumn{
+		{Name: "date", Start: 1, End: 10},
+		{Name: "name", Start: 11, End: 18},
+		{Name: "amount", Start: 19, End: 26},
+	}
+	data, err := ReadFixedWidth(filePath, columns)
+	if err != nil {
+		t.Fatalf("ReadFixedWidth() error = %v", err)
+	}
+
+	want := [][]string{
+		{"date", "name", "amount"},
+		{"2024-03-05", "张三", "100.00"},
+		{"2024-03-06", "abcd", "-20.50"},
+	}
+	if !reflect.DeepEqual(data, want) {
+		t.Errorf("ReadFixedWidth() = %v, want %v", data, want)
+	}
+}
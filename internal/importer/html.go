@@ -0,0 +1,259 @@
+package importer
+
+import (
+	"bytes"
+	"os"
+	"strconv"
+	"strings"
+
+	"csvsql/pkg/format"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// htmlFormat reads every table of an HTML page
+type htmlFormat struct{}
+
+func (htmlFormat) Name() string         { return "html" }
+func (htmlFormat) Extensions() []string { return []string{".html", ".htm"} }
+
+func (htmlFormat) Detect(head []byte) bool {
+	head = bytes.ToLower(trimHead(head))
+	return bytes.HasPrefix(head, []byte("<!doctype html")) || bytes.HasPrefix(head, []byte("<html"))
+}
+
+func (htmlFormat) Tables(filePath string, opts format.Options) ([]*Table, error) {
+	tables, err := ReadHTML(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return numberedTables("html", filePath, tables), nil
+}
+
+// htmlCell is a table cell with its span attributes
+type htmlCell struct {
+	text    string
+	header  bool
+	colspan int
+	rowspan int
+}
+
+// ReadHTML reads every <table> of an HTML file. Leading rows made of <th>
+// cells (or rows inside <thead>) become the header; colspan and rowspan are
+// expanded so that spanned cells repeat their value.
+func ReadHTML(filePath string) ([][][]string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	doc, err := html.Parse(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var tables [][][]string
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.DataAtom == atom.Table {
+			if data := htmlTableData(n); len(data) > 0 {
+				tables = append(tables, data)
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+
+	return tables, nil
+}
+
+// htmlTableData converts a <table> node into a header row followed by data rows
+func htmlTableData(table *html.Node) [][]string {
+	var rows [][]htmlCell
+	var headerRows int
+	for _, tr := range htmlTableRows(table) {
+		var cells []htmlCell
+		for td := tr.FirstChild; td != nil; td = td.NextSibling {
+			if td.Type != html.ElementNode || (td.DataAtom != atom.Td && td.DataAtom != atom.Th) {
+				continue
+			}
+			cells = append(cells, htmlCell{
+				text:    htmlText(td),
+				header:  td.DataAtom == atom.Th || (tr.Parent != nil && tr.Parent.DataAtom == atom.Thead),
+				colspan: htmlSpan(td, "colspan"),
+				rowspan: htmlSpan(td, "rowspan"),
+			})
+		}
+		if len(cells) == 0 {
+			continue
+		}
+		if headerRows == len(rows) && allHeaderCells(cells) {
+			headerRows++
+		}
+		rows = append(rows, cells)
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+
+	grid := expandSpans(rows)
+	if headerRows == 0 {
+		headerRows = 1
+	}
+	if headerRows > len(grid) {
+		headerRows = len(grid)
+	}
+
+	data := [][]string{mergeHeaderRows(grid[:headerRows])}
+	data = append(data, grid[headerRows:]...)
+	return data
+}
+
+// htmlTableRows returns the <tr> elements that belong to a table, skipping nested tables
+func htmlTableRows(table *html.Node) []*html.Node {
+	var rows []*html.Node
+	for c := table.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != html.ElementNode {
+			continue
+		}
+		switch c.DataAtom {
+		case atom.Tr:
+			rows = append(rows, c)
+		case atom.Thead, atom.Tbody, atom.Tfoot:
+			for tr := c.FirstChild; tr != nil; tr = tr.NextSibling {
+				if tr.Type == html.ElementNode && tr.DataAtom == atom.Tr {
+					rows = append(rows, tr)
+				}
+			}
+		}
+	}
+	return rows
+}
+
+// expandSpans lays cells out on a rectangular grid, copying spanned values
+func expandSpans(rows [][]htmlCell) [][]string {
+	var grid [][]string
+	// pending holds values carried down by rowspan, keyed by column
+	type carry struct {
+		text string
+		left int
+	}
+	pending := make(map[int]carry)
+	width := 0
+
+	for _, cells := range rows {
+		var row []string
+		col := 0
+		fill := func() {
+			for {
+				p, ok := pending[col]
+				if !ok {
+					return
+				}
+				row = append(row, p.text)
+				if p.left--; p.left == 0 {
+					delete(pending, col)
+				} else {
+					pending[col] = p
+				}
+				col++
+			}
+		}
+
+		for _, cell := range cells {
+			fill()
+			for i := 0; i < cell.colspan; i++ {
+				row = append(row, cell.text)
+				if cell.rowspan > 1 {
+					pending[col] = carry{text: cell.text, left: cell.rowspan - 1}
+				}
+				col++
+			}
+		}
+		fill()
+
+		if len(row) > width {
+			width = len(row)
+		}
+		grid = append(grid, row)
+	}
+
+	for i, row := range grid {
+		if len(row) < width {
+			grid[i] = append(row, make([]string, width-len(row))...)
+		}
+	}
+	return grid
+}
+
+// mergeHeaderRows combines stacked header rows into one name per column,
+// e.g. a "2024" cell spanning "Q1" and "Q2" yields "2024_Q1" and "2024_Q2"
+func mergeHeaderRows(headerRows [][]string) []string {
+	headers := make([]string, len(headerRows[0]))
+	for col := range headers {
+		var parts []string
+		for _, row := range headerRows {
+			text := row[col]
+			if text == "" || (len(parts) > 0 && parts[len(parts)-1] == text) {
+				continue
+			}
+			parts = append(parts, text)
+		}
+		headers[col] = strings.Join(parts, "_")
+		if headers[col] == "" {
+			headers[col] = "column" + strconv.Itoa(col+1)
+		}
+	}
+	return headers
+}
+
+// allHeaderCells reports whether every cell of a row is a header cell
+func allHeaderCells(cells []htmlCell) bool {
+	for _, c := range cells {
+		if !c.header {
+			return false
+		}
+	}
+	return true
+}
+
+// maxSpan holds the largest colspan and rowspan browsers honour
+var maxSpan = map[string]int{"colspan": 1000, "rowspan": 65534}
+
+// htmlSpan reads a colspan or rowspan attribute, defaulting to 1 and clamped
+// as browsers do, so a stray huge span cannot exhaust memory
+func htmlSpan(n *html.Node, name string) int {
+	for _, attr := range n.Attr {
+		if strings.EqualFold(attr.Key, name) {
+			if v, err := strconv.Atoi(strings.TrimSpace(attr.Val)); err == nil && v > 0 {
+				return min(v, maxSpan[name])
+			}
+		}
+	}
+	return 1
+}
+
+// htmlText returns the visible text of a node with whitespace collapsed
+func htmlText(n *html.Node) string {
+	var b strings.Builder
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		switch {
+		case n.Type == html.TextNode:
+			b.WriteString(n.Data)
+		case n.Type == html.ElementNode && n.DataAtom == atom.Br:
+			b.WriteByte(' ')
+		case n.Type == html.ElementNode && (n.DataAtom == atom.Script || n.DataAtom == atom.Style):
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return strings.Join(strings.Fields(b.String()), " ")
+}
@@ -0,0 +1,117 @@
+package importer
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestReadHTML(t *testing.T) {
+	filePath := writeTempFile(t, "report.html", `<html><body>
+<table>
+  <thead>
+    <tr><th rowspan="2">地区</th><th colspan="2">2024</th></tr>
+    <tr><th>Q1</th><th>Q2</th></tr>
+  </thead>
+  <tbody>
+    <tr><td rowspan="2">华东</td><td>1</td><td>2</td></tr>
+    <tr><td>3</td><td>4</td></tr>
+    <tr><td>华北</td><td colspan="2">n/a</td></tr>
+  </tbody>
+</table>
+<table><tr><td>a</td><td>b</td></tr><tr><td>1<br>2</td><td> x  y </td></tr></table>
+</body></html>`)
+
+	tables, err := ReadHTML(filePath)
+	if err != nil {
+		t.Fatalf("ReadHTML() error = %v", err)
+	}
+
+	want := [][][]string{
+		{
+			{"地区", "2024_Q1", "2024_Q2"},
+			{"华东", "1", "2"},
+			{"华东", "3", "4"},
+			{"华北", "n/a", "n/a"},
+		},
+		{
+			{"a", "b"},
+			{"1 2", "x y"},
+		},
+	}
+	if !reflect.DeepEqual(tables, want) {
+		t.Errorf("ReadHTML() = %v, want %v", tables, want)
+	}
+}
+
+func TestReadMarkdown(t *testing.T) {
+	filePath := writeTempFile(t, "wiki.md", "# Report\n\n"+
+		"| 名称 | 值 |\n"+
+		"|:-----|---:|\n"+
+		"| a \\| b | 1 |\n"+
+		"| c |\n"+
+		"\n"+
+		"```\n| x | y |\n|---|---|\n```\n"+
+		"k | v\n--- | ---\n1 | 2 | 3\n")
+
+	tables, err := ReadMarkdown(filePath)
+	if err != nil {
+		t.Fatalf("ReadMarkdown() error = %v", err)
+	}
+
+	want := [][][]string{
+		{
+			{"名称", "值"},
+			{"a | b", "1"},
+			{"c", ""},
+		},
+		{
+			{"k", "v"},
+			{"1", "2"},
+		},
+	}
+	if !reflect.DeepEqual(tables, want) {
+		t.Errorf("ReadMarkdown() = %v, want %v", tables, want)
+	}
+}
+
+func TestReadMarkdownFenceAfterTable(t *testing.T) {
+	// A fence right after a table opens a code block rather than closing one
+	filePath := writeTempFile(t, "notes.md", "| a | b |\n|---|---|\n| 1 | 2 |\n"+
+		"```\n| x | y |\n|---|---|\n```\n"+
+		"| c |\n|---|\n| 3 |\n")
+
+	tables, err := ReadMarkdown(filePath)
+	if err != nil {
+		t.Fatalf("ReadMarkdown() error = %v", err)
+	}
+	want := [][][]string{
+		{{"a", "b"}, {"1", "2"}},
+		{{"c"}, {"3"}},
+	}
+	if !reflect.DeepEqual(tables, want) {
+		t.Errorf("ReadMarkdown() = %v, want %v", tables, want)
+	}
+}
+
+func TestReadHTMLHugeSpan(t *testing.T) {
+	// Spans are clamped as browsers do instead of allocating billions of cells
+	filePath := writeTempFile(t, "span.html", `<table>
+<tr><th>a</th><th colspan="2000000000">b</th></tr>
+<tr><td rowspan="99999999">1</td><td>2</td></tr>
+<tr><td>3</td></tr>
+</table>`)
+
+	tables, err := ReadHTML(filePath)
+	if err != nil {
+		t.Fatalf("ReadHTML() error = %v", err)
+	}
+	if len(tables) != 1 || len(tables[0]) != 3 {
+		t.Fatalf("ReadHTML() = %d tables, want one of 3 rows", len(tables))
+	}
+	if width := len(tables[0][0]); width != 1001 {
+		t.Errorf("header width = %d, want 1001", width)
+	}
+	if got := tables[0][2][0]; got != "1" {
+		t.Errorf("carried cell = %q, want 1", got)
+	}
+}
@@ -0,0 +1,274 @@
+package importer
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"csvsql/pkg/format"
+)
+
+// logFormat reads log files using the configured preset or regular expression
+type logFormat struct{}
+
+func (logFormat) Name() string            { return "log" }
+func (logFormat) Extensions() []string    { return []string{".log"} }
+func (logFormat) Detect(head []byte) bool { return false }
+
+func (logFormat) Tables(filePath string, opts format.Options) ([]*Table, error) {
+	if opts.LogPattern == "" {
+		return nil, fmt.Errorf("log file %s requires a pattern (--log-pattern), presets: %s",
+			filePath, strings.Join(LogPresetNames(), ", "))
+	}
+	t, err := openLog(filePath, opts.LogPattern)
+	if err != nil {
+		return nil, err
+	}
+	return []*Table{t}, nil
+}
+
+// LogPresets maps built-in log format names to regular expressions.
+// Every named capture group becomes a column.
+var LogPresets = map[string]string{
+	"common": `^(?P<remote_addr>\S+) (?P<ident>\S+) (?P<remote_user>\S+) \[(?P<time_local>[^\]]+)\] ` +
+		`"(?:(?P<method>[A-Z]+) (?P<path>\S+)(?: (?P<protocol>[^"]*))?|[^"]*)" ` +
+		`(?P<status>\d{3}) (?P<body_bytes_sent>\S+)`,
+	"combined": `^(?P<remote_addr>\S+) (?P<ident>\S+) (?P<remote_user>\S+) \[(?P<time_local>[^\]]+)\] ` +
+		`"(?:(?P<method>[A-Z]+) (?P<path>\S+)(?: (?P<protocol>[^"]*))?|[^"]*)" ` +
+		`(?P<status>\d{3}) (?P<body_bytes_sent>\S+) "(?P<http_referer>[^"]*)" "(?P<http_user_agent>[^"]*)"`,
+}
+
+// LogfmtPreset is the name of the built-in key=value log format
+const LogfmtPreset = "logfmt"
+
+func init() {
+	LogPresets["apache"] = LogPresets["common"]
+	LogPresets["nginx"] = LogPresets["combined"]
+}
+
+// LogPresetNames returns the names of all built-in log formats
+func LogPresetNames() []string {
+	names := []string{LogfmtPreset}
+	for name := range LogPresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ReadLog reads a log file line by line. The pattern is either the name of a
+// built-in preset or a regular expression with named capture groups. Lines
+// that do not match are returned as rejects.
+func ReadLog(filePath, pattern string) ([][]string, []format.Reject, error) {
+	t, err := openLog(filePath, pattern)
+	if err != nil {
+		return nil, nil, err
+	}
+	data, err := collectRecords(t)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, t.Meta.Rejects, nil
+}
+
+// openLog prepares a log file for reading with a preset or regular expression
+func openLog(filePath, pattern string) (*Table, error) {
+	if pattern == LogfmtPreset {
+		return openLogfmt(filePath), nil
+	}
+
+	detail := pattern
+	if preset, ok := LogPresets[pattern]; ok {
+		pattern = preset
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid log pattern: %v", err)
+	}
+
+	var headers []string
+	var groups []int
+	for i, name := range re.SubexpNames() {
+		if name != "" {
+			headers = append(headers, name)
+			groups = append(groups, i)
+		}
+	}
+	if len(headers) == 0 {
+		return nil, fmt.Errorf("log pattern has no named groups, use (?P<name>...) to define columns")
+	}
+
+	t := &Table{Meta: Metadata{Format: "log", Source: filePath, Detail: detail}}
+	t.Records = func(yield func([]string, error) bool) {
+		t.Meta.Rejects = nil
+		if !yield(headers, nil) {
+			return
+		}
+
+		err := scanLines(filePath, func(lineNo int, line string) bool {
+			match := re.FindStringSubmatch(line)
+			if match == nil {
+				t.Meta.Rejects = append(t.Meta.Rejects, format.Reject{
+					Line:    lineNo,
+					Raw:     line,
+					Reason:  "line does not match log pattern",
+					Skipped: true,
+				})
+				return true
+			}
+			record := make([]string, len(groups))
+			for i, g := range groups {
+				record[i] = match[g]
+			}
+			return yield(record, nil)
+		})
+		if err != nil {
+			yield(nil, err)
+		}
+	}
+	return t, nil
+}
+
+// openLogfmt reads key=value structured logs; every key seen becomes a column.
+// The whole file is read before the header is known.
+func openLogfmt(filePath string) *Table {
+	t := &Table{Meta: Metadata{Format: "log", Source: filePath, Detail: LogfmtPreset}}
+	t.Records = func(yield func([]string, error) bool) {
+		var headers []string
+		columns := make(map[string]int)
+		var records []map[string]string
+		t.Meta.Rejects = nil
+
+		err := scanLines(filePath, func(lineNo int, line string) bool {
+			pairs, ok := parseLogfmt(line)
+			if !ok {
+				t.Meta.Rejects = append(t.Meta.Rejects, format.Reject{
+					Line:    lineNo,
+					Raw:     line,
+					Reason:  "line is not in logfmt format",
+					Skipped: true,
+				})
+				return true
+			}
+			record := make(map[string]string, len(pairs))
+			for _, kv := range pairs {
+				if _, seen := columns[kv[0]]; !seen {
+					columns[kv[0]] = len(headers)
+					headers = append(headers, kv[0])
+				}
+				record[kv[0]] = kv[1]
+			}
+			records = append(records, record)
+			return true
+		})
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+
+		if len(headers) == 0 || !yield(headers, nil) {
+			return
+		}
+		for _, record := range records {
+			row := make([]string, len(headers))
+			for key, value := range record {
+				row[columns[key]] = value
+			}
+			if !yield(row, nil) {
+				return
+			}
+		}
+	}
+	return t
+}
+
+// parseLogfmt splits a logfmt line into key/value pairs. Values may be
+// double-quoted with backslash escapes; a bare key has an empty value.
+func parseLogfmt(line string) ([][2]string, bool) {
+	var pairs [][2]string
+	hasValue := false
+	i := 0
+	for i < len(line) {
+		for i < len(line) && line[i] == ' ' {
+			i++
+		}
+		if i >= len(line) {
+			break
+		}
+
+		start := i
+		for i < len(line) && line[i] != '=' && line[i] != ' ' {
+			i++
+		}
+		key := line[start:i]
+		if key == "" {
+			return nil, false
+		}
+
+		value := ""
+		if i < len(line) && line[i] == '=' {
+			hasValue = true
+			i++
+			if i < len(line) && line[i] == '"' {
+				var b strings.Builder
+				i++
+				closed := false
+				for i < len(line) {
+					c := line[i]
+					if c == '\\' && i+1 < len(line) {
+						b.WriteByte(line[i+1])
+						i += 2
+						continue
+					}
+					if c == '"' {
+						closed = true
+						i++
+						break
+					}
+					b.WriteByte(c)
+					i++
+				}
+				if !closed {
+					return nil, false
+				}
+				value = b.String()
+			} else {
+				start = i
+				for i < len(line) && line[i] != ' ' {
+					i++
+				}
+				value = line[start:i]
+			}
+		}
+		pairs = append(pairs, [2]string{key, value})
+	}
+	return pairs, hasValue
+}
+
+// scanLines calls fn for every non-empty line of a file with its 1-based line
+// number, stopping early when fn returns false
+func scanLines(filePath string, fn func(lineNo int, line string) bool) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if !fn(lineNo, line) {
+			return nil
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,132 @@
+package importer
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"csvsql/internal/database"
+	"csvsql/pkg/format"
+)
+
+func TestReadLog(t *testing.T) {
+	tests := []struct {
+		name        string
+		pattern     string
+		content     string
+		want        [][]string
+		wantRejects []format.Reject
+	}{
+		{
+			"named groups",
+			`^(?P<level>[A-Z]+) (?:\S+) (?P<user>\w+)$`,
+			"INFO 10:00 alice\nnot a log line\n\nWARN 10:01 bob\r\n",
+			[][]string{{"level", "user"}, {"INFO", "alice"}, {"WARN", "bob"}},
+			[]format.Reject{{Line: 2, Raw: "not a log line", Reason: "line does not match log pattern", Skipped: true}},
+		},
+		{
+			"unnamed groups are not columns",
+			`^(\d+) (?P<msg>.*)$`,
+			"1 started\n2 stopped\n",
+			[][]string{{"msg"}, {"started"}, {"stopped"}},
+			nil,
+		},
+		{
+			"common preset",
+			"common",
+			`127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /index.html HTTP/1.0" 200 2326` + "\n" +
+				`127.0.0.1 - - [10/Oct/2000:13:55:37 -0700] "-" 408 -` + "\n" +
+				"garbage\n",
+			[][]string{
+				{"remote_addr", "ident", "remote_user", "time_local", "method", "path", "protocol", "status", "body_bytes_sent"},
+				{"127.0.0.1", "-", "frank", "10/Oct/2000:13:55:36 -0700", "GET", "/index.html", "HTTP/1.0", "200", "2326"},
+				{"127.0.0.1", "-", "-", "10/Oct/2000:13:55:37 -0700", "", "", "", "408", "-"},
+			},
+			[]format.Reject{{Line: 3, Raw: "garbage", Reason: "line does not match log pattern", Skipped: true}},
+		},
+		{
+			"logfmt",
+			LogfmtPreset,
+			"level=info msg=\"user logged in\" user=张三\nplain text\nlevel=warn latency=12ms\n",
+			[][]string{
+				{"level", "msg", "user", "latency"},
+				{"info", "user logged in", "张三", ""},
+				{"warn", "", "", "12ms"},
+			},
+			[]format.Reject{{Line: 2, Raw: "plain text", Reason: "line is not in logfmt format", Skipped: true}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, rejects, err := ReadLog(writeTempFile(t, "app.log", tt.content), tt.pattern)
+			if err != nil {
+				t.Fatalf("ReadLog() error = %v", err)
+			}
+			if !reflect.DeepEqual(data, tt.want) {
+				t.Errorf("ReadLog() data = %q, want %q", data, tt.want)
+			}
+			if !reflect.DeepEqual(rejects, tt.wantRejects) {
+				t.Errorf("ReadLog() rejects = %+v, want %+v", rejects, tt.wantRejects)
+			}
+		})
+	}
+
+	filePath := writeTempFile(t, "app.log", "x\n")
+	for _, pattern := range []string{`(?P<open`, `^(\w+)$`} {
+		if _, _, err := ReadLog(filePath, pattern); err == nil {
+			t.Errorf("ReadLog(%q) should fail", pattern)
+		}
+	}
+}
+
+func TestLoadLogRejects(t *testing.T) {
+	processor, dbManager := newTestProcessor(t)
+	processor.cfg.LogPattern = `^(?P<level>[A-Z]+) (?P<msg>.*)$`
+	if err := processor.LoadFile(writeTempFile(t, "app.log", "INFO up\n-- marker --\nWARN slow\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := dbManager.ExecuteQuery(context.Background(), "SELECT table_name, line, raw FROM "+database.RejectsTable+";")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := [][]string{{"table_name", "line", "raw"}, {"app", "2", "-- marker --"}}; !reflect.DeepEqual(got.Table(""), want) {
+		t.Errorf("rejects = %q, want %q", got.Table(""), want)
+	}
+	got, err = dbManager.ExecuteQuery(context.Background(), "SELECT count(*) FROM app;")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rows := got.Table("")[1][0]; rows != "2" {
+		t.Errorf("rows loaded = %s, want 2", rows)
+	}
+}
+
+func TestParseLogfmt(t *testing.T) {
+	tests := []struct {
+		line   string
+		want   [][2]string
+		wantOK bool
+	}{
+		{"a=1 b=two", [][2]string{{"a", "1"}, {"b", "two"}}, true},
+		{`msg="hello world"`, [][2]string{{"msg", "hello world"}}, true},
+		{`msg="say \"hi\"" path="C:\\tmp"`, [][2]string{{"msg", `say "hi"`}, {"path", `C:\tmp`}}, true},
+		{`q="a=b c" empty="" n=`, [][2]string{{"q", "a=b c"}, {"empty", ""}, {"n", ""}}, true},
+		{"debug a=1", [][2]string{{"debug", ""}, {"a", "1"}}, true},
+		{"  a=1   b=2  ", [][2]string{{"a", "1"}, {"b", "2"}}, true},
+		{"城市=北京 备注=\"上海 浦东\"", [][2]string{{"城市", "北京"}, {"备注", "上海 浦东"}}, true},
+		{`msg="unterminated`, nil, false},
+		{"=1", nil, false},
+		{"just some words", nil, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseLogfmt(tt.line)
+		if ok != tt.wantOK {
+			t.Errorf("parseLogfmt(%q) ok = %v, want %v", tt.line, ok, tt.wantOK)
+			continue
+		}
+		if ok && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseLogfmt(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package importer
+
+import (
+	"bufio"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"csvsql/pkg/format"
+)
+
+// markdownFormat reads every pipe table of a Markdown document
+type markdownFormat struct{}
+
+func (markdownFormat) Name() string            { return "markdown" }
+func (markdownFormat) Extensions() []string    { return []string{".md", ".markdown"} }
+func (markdownFormat) Detect(head []byte) bool { return false }
+
+func (markdownFormat) Tables(filePath string, opts format.Options) ([]*Table, error) {
+	tables, err := ReadMarkdown(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return numberedTables("markdown", filePath, tables), nil
+}
+
+// markdownDelimiter matches a cell of the delimiter row, e.g. "---", ":--" or ":-:"
+var markdownDelimiter = regexp.MustCompile(`^:?-+:?$`)
+
+// ReadMarkdown reads every pipe table of a Markdown file. A table is a header
+// line followed by a delimiter row such as |---|:---:|, and ends at the first
+// line without a pipe.
+func ReadMarkdown(filePath string) ([][][]string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		lines = append(lines, strings.TrimSuffix(scanner.Text(), "\r"))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	var tables [][][]string
+	inFence := false
+	for i := 0; i < len(lines); i++ {
+		trimmed := strings.TrimSpace(lines[i])
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			inFence = !inFence
+			continue
+		}
+		if inFence || i+1 >= len(lines) || !strings.Contains(lines[i], "|") {
+			continue
+		}
+
+		headers := splitMarkdownRow(lines[i])
+		if !isMarkdownDelimiter(lines[i+1], len(headers)) {
+			continue
+		}
+
+		for j, h := range headers {
+			if h == "" {
+				headers[j] = "column" + strconv.Itoa(j+1)
+			}
+		}
+
+		data := [][]string{headers}
+		i += 2
+		for ; i < len(lines); i++ {
+			if strings.TrimSpace(lines[i]) == "" || !strings.Contains(lines[i], "|") {
+				break
+			}
+			row := splitMarkdownRow(lines[i])
+			// Rows are padded or truncated to the header width, as renderers do
+			if len(row) < len(headers) {
+				row = append(row, make([]string, len(headers)-len(row))...)
+			}
+			data = append(data, row[:len(headers)])
+		}
+		// The line that ended the table, such as a code fence, is read again
+		i--
+		tables = append(tables, data)
+	}
+
+	return tables, nil
+}
+
+// splitMarkdownRow splits a pipe table row into trimmed cells, honouring \| escapes
+func splitMarkdownRow(line string) []string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimPrefix(line, "|")
+	if strings.HasSuffix(line, "|") && !strings.HasSuffix(line, `\|`) {
+		line = strings.TrimSuffix(line, "|")
+	}
+
+	var cells []string
+	var cell strings.Builder
+	for i := 0; i < len(line); i++ {
+		switch {
+		case line[i] == '\\' && i+1 < len(line) && line[i+1] == '|':
+			cell.WriteByte('|')
+			i++
+		case line[i] == '|':
+			cells = append(cells, strings.TrimSpace(cell.String()))
+			cell.Reset()
+		default:
+			cell.WriteByte(line[i])
+		}
+	}
+	return append(cells, strings.TrimSpace(cell.String()))
+}
+
+// isMarkdownDelimiter reports whether a line is the delimiter row of a table with the given width
+func isMarkdownDelimiter(line string, width int) bool {
+	if !strings.Contains(line, "-") {
+		return false
+	}
+	cells := splitMarkdownRow(line)
+	if len(cells) != width {
+		return false
+	}
+	for _, c := range cells {
+		if !markdownDelimiter.MatchString(c) {
+			return false
+		}
+	}
+	return true
+}
@@ -1,67 +1,595 @@
 package importer
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
+	"maps"
+	"os"
 	"path/filepath"
+	"runtime"
+	"slices"
 	"strings"
+	"sync"
+	"time"
 
+	"csvsql/config"
 	"csvsql/internal/database"
+	"csvsql/internal/zh"
+	"csvsql/pkg/format"
 	"csvsql/pkg/utils"
 )
 
 // Processor handles file loading and processing
 type Processor struct {
 	dbManager *database.Manager
+	cfg       *config.Config
+	registry  *Registry
+
+	mu       sync.Mutex // serialises loads and guards sources
+	sources  []*database.SourceRecord
+	batch    map[string]string // sources of the tables loaded by the running LoadFiles, by table
+	attached []string          // downloaded databases kept while attached, removed by Close
+	out      io.Writer         // receives progress messages
+	progress io.Writer         // receives progress bars from LoadFiles, if set
+}
+
+// TableSummary describes a table loaded from a file
+type TableSummary struct {
+	Table    string
+	Source   string
+	Rows     int
+	Columns  int
+	Duration time.Duration // time spent reading and writing the table
+}
+
+// LoadResult is the outcome of loading one file with LoadFiles
+type LoadResult struct {
+	Path   string
+	Tables []TableSummary // tables created or updated, empty if skipped
+	Err    error
 }
 
-// NewProcessor creates a new file processor
-func NewProcessor(dbManager *database.Manager) *Processor {
+// NewProcessor creates a new file processor using the built-in readers and
+// those added with format.Register, which take precedence
+func NewProcessor(dbManager *database.Manager, cfg *config.Config) *Processor {
+	registry := format.NewRegistry(Builtins.Readers()...)
+	for _, reader := range format.Default.Readers() {
+		registry.Register(reader)
+	}
+	return NewProcessorWithRegistry(dbManager, cfg, registry)
+}
+
+// NewProcessorWithRegistry creates a new file processor using the given readers
+func NewProcessorWithRegistry(dbManager *database.Manager, cfg *config.Config, registry *Registry) *Processor {
 	return &Processor{
 		dbManager: dbManager,
+		cfg:       cfg,
+		registry:  registry,
+		out:       os.Stdout,
 	}
 }
 
-// LoadFile dispatches to the correct parser based on file extension
+// LoadFile finds the reader for a file and loads every table it contains.
+// HTTP(S) URLs are downloaded to a temporary file first. A file that is
+// unchanged since it was last imported into the database is skipped.
 func (p *Processor) LoadFile(filePath string) error {
-	// Get the original file path for reading, only sanitize the table name
-	tableName := strings.TrimSuffix(filepath.Base(filePath), filepath.Ext(filePath))
-	// Sanitize table name to be valid SQL
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.loadSource(filePath, false)
+}
+
+// ShowProgress makes LoadFiles draw a progress bar per file on w, which
+// should be a terminal
+func (p *Processor) ShowProgress(w io.Writer) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.progress = w
+}
+
+// maxReadAhead bounds the files LoadFiles reads ahead of the one being
+// written, each of which is held in memory until its turn
+const maxReadAhead = 4
+
+// LoadFiles loads several files or URLs. Files are downloaded, hashed and
+// read concurrently, while tables are written to the database one at a time
+// in the order of filePaths. At most a few files are read ahead, so loading
+// many large files does not hold them all in memory.
+func (p *Processor) LoadFiles(filePaths []string) []LoadResult {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.batch = make(map[string]string)
+	defer func() { p.batch = nil }()
+
+	jobs := make([]*loadJob, len(filePaths))
+	errs := make([]error, len(filePaths))
+	ready := make([]chan struct{}, len(filePaths))
+	progs := make([]*progress, len(filePaths))
+	for i, filePath := range filePaths {
+		ready[i] = make(chan struct{})
+		progs[i] = newProgress(filePath)
+	}
+
+	// Files are started in order as earlier ones are written, so the file
+	// written next is always being read
+	window := make(chan struct{}, min(runtime.GOMAXPROCS(0), maxReadAhead))
+	go func() {
+		for i, filePath := range filePaths {
+			window <- struct{}{}
+			go func() {
+				defer close(ready[i])
+				jobs[i], errs[i] = p.prepare(filePath, false, progs[i], true)
+			}()
+		}
+	}()
+
+	// Messages are held back while the progress bars are drawn
+	if p.progress != nil {
+		out := p.out
+		var messages bytes.Buffer
+		p.out = &messages
+		display := startProgress(p.progress, progs)
+		defer func() {
+			display.Stop()
+			p.out = out
+			io.Copy(out, &messages)
+		}()
+	}
+
+	results := make([]LoadResult, len(filePaths))
+	for i, filePath := range filePaths {
+		<-ready[i]
+		job, err := jobs[i], errs[i]
+		if err == nil {
+			err = p.commit(job, false)
+		}
+		p.cleanup(job, err == nil)
+		progs[i].finish(job, err)
+		results[i] = LoadResult{Path: filePath, Tables: job.results, Err: err}
+		// Let go of the records before the next file is read
+		job.tables = nil
+		<-window
+	}
+	return results
+}
+
+// Import merges the only table of a file or URL into tableName, creating it
+// if it does not exist. Unknown headers become new columns; with a key, rows
+// whose key value is already present update the existing rows. The table
+// keeps its original source, so a reload does not repeat the import.
+func (p *Processor) Import(filePath, tableName, key string) (result database.MergeResult, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
 	tableName = utils.SanitizeTableName(tableName)
+	job, err := p.prepare(filePath, true, newProgress(filePath), false)
+	defer func() { p.cleanup(job, false) }()
+	if err != nil {
+		return result, err
+	}
+	if _, ok := job.reader.(DatabaseLoader); ok {
+		return result, fmt.Errorf("%s is not a table and cannot be imported", filePath)
+	}
+	if len(job.tables) != 1 {
+		return result, fmt.Errorf("%s contains %d tables, expected one", filePath, len(job.tables))
+	}
+	t := job.tables[0]
+	t.Meta.Source = filePath
 
-	var data [][]string
-	var err error
+	exists, err := p.dbManager.TableExists(tableName)
+	if err != nil {
+		return result, err
+	}
+	if exists {
+		result, err = p.dbManager.MergeRows(tableName, t.Records, key)
+	} else {
+		result.Inserted, err = p.dbManager.CreateAndInsertRows(tableName, t.Records)
+	}
+	if err != nil {
+		if errors.Is(err, database.ErrEmptyData) {
+			return result, fmt.Errorf("no data found in file: %s", filePath)
+		}
+		return result, fmt.Errorf("failed to import data into table %s: %v", tableName, err)
+	}
 
-	switch strings.ToLower(filepath.Ext(filePath)) {
-	case ".csv":
-		data, err = p.readCSV(filePath)
-	case ".xlsx":
-		data, err = p.readXLSX(filePath)
-	default:
-		return fmt.Errorf("unsupported file type: %s", filePath)
+	return result, p.reportRejects(tableName, filePath, t.Meta.Rejects)
+}
+
+// loadSource loads a file or URL and records it as the source of its tables.
+// A reload always replaces existing tables; otherwise the import policy decides.
+func (p *Processor) loadSource(filePath string, reload bool) error {
+	job, err := p.prepare(filePath, reload, newProgress(filePath), false)
+	if err == nil {
+		err = p.commit(job, reload)
+	}
+	p.cleanup(job, err == nil)
+	return err
+}
+
+// loadJob is a file or URL on its way into the database
+type loadJob struct {
+	path      string // file path or URL as given
+	localPath string // file that is read, a temporary download for URLs
+	tableName string
+	src       *database.SourceRecord
+	upToDate  bool
+	reader    Reader
+	tables    []*Table
+	parseTime []time.Duration // time spent reading each table, when read in advance
+	progress  *progress
+	results   []TableSummary
+}
+
+// prepare downloads, checks and opens a file without writing to the
+// database, so several files can be prepared concurrently. With readAhead
+// the tables are read into memory; otherwise they are streamed by commit.
+// The returned job is never nil and must be cleaned up.
+func (p *Processor) prepare(filePath string, reload bool, prog *progress, readAhead bool) (*loadJob, error) {
+	job := &loadJob{path: filePath, localPath: filePath, progress: prog}
+
+	if IsURL(filePath) {
+		localPath, err := Download(filePath, p.cfg.MaxFileSize)
+		if err != nil {
+			return job, err
+		}
+		job.localPath = localPath
+		job.tableName = URLTableName(filePath)
+		job.src = &database.SourceRecord{Path: filePath}
+	} else {
+		// Get the original file path for reading, only sanitize the table name
+		tableName := strings.TrimSuffix(filepath.Base(filePath), filepath.Ext(filePath))
+		// Sanitize table name to be valid SQL
+		job.tableName = utils.SanitizeTableName(tableName)
+
+		src, err := statSource(filePath)
+		if err != nil {
+			return job, err
+		}
+		job.src = src
+
+		if !reload {
+			if job.upToDate, err = p.upToDate(src); err != nil || job.upToDate {
+				return job, err
+			}
+		}
+	}
+
+	reader, err := p.registry.Lookup(job.localPath, p.options())
+	if err != nil {
+		return job, err
+	}
+	job.reader = reader
+	if _, ok := reader.(DatabaseLoader); ok {
+		return job, nil
+	}
+
+	if job.tables, err = reader.Tables(job.localPath, p.options()); err != nil {
+		return job, err
+	}
+	if err := p.transformTables(job.tables); err != nil {
+		return job, err
+	}
+	if !readAhead {
+		return job, nil
+	}
+
+	prog.setState(stateReading)
+	for _, t := range job.tables {
+		start := time.Now()
+		data, err := collectRecords(&Table{Records: countRecords(t.Records, &prog.read, nil)})
+		if err != nil {
+			return job, err
+		}
+		t.Records = sliceRecords(data)
+		job.parseTime = append(job.parseTime, time.Since(start))
+	}
+	return job, nil
+}
+
+// transformTables applies the configured clean spec and date recognition
+// to the records of tables
+func (p *Processor) transformTables(tables []*Table) error {
+	parser, err := p.dateParser()
+	if err != nil {
+		return err
+	}
+
+	if p.cfg.Clean != "" {
+		rules, err := LoadCleanSpec(p.cfg.Clean)
+		if err != nil {
+			return err
+		}
+		transforms := maps.Clone(Transforms)
+		maps.Copy(transforms, dateTransforms(parser))
+		for _, t := range tables {
+			t.Records = cleanRecords(t.Records, rules, transforms)
+		}
+	}
+
+	if p.cfg.DetectDates {
+		for _, t := range tables {
+			t.Records = detectDates(t.Records, parser)
+		}
+	}
+	return nil
+}
+
+// dateParser creates a date parser using the configured formats and time zone
+func (p *Processor) dateParser() (*zh.DateParser, error) {
+	parser := &zh.DateParser{Layouts: p.cfg.DateFormats}
+	if p.cfg.TimeZone != "" {
+		loc, err := time.LoadLocation(p.cfg.TimeZone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid time zone %s: %v", p.cfg.TimeZone, err)
+		}
+		parser.Location = loc
+	}
+	return parser, nil
+}
+
+// options returns the settings passed to readers
+func (p *Processor) options() format.Options {
+	return format.Options{
+		Lenient:    p.cfg.Lenient,
+		FixedSpec:  p.cfg.FixedSpec,
+		LogPattern: p.cfg.LogPattern,
+		XMLPath:    p.cfg.XMLPath,
+	}
+}
+
+// commit writes a prepared job to the database and records its source
+func (p *Processor) commit(job *loadJob, reload bool) error {
+	if job.upToDate {
+		for _, name := range job.src.Tables {
+			fmt.Fprintf(p.out, "Table '%s' is up to date with %s, import skipped.\n", name, job.path)
+		}
+		p.recordSource(job.src)
+		return nil
+	}
+
+	if loader, ok := job.reader.(DatabaseLoader); ok {
+		if err := p.commitDatabase(job, loader, reload); err != nil {
+			return err
+		}
+	} else if err := p.commitTables(job, reload); err != nil {
+		return err
+	}
+
+	if job.src.Hash != "" {
+		if err := p.dbManager.RecordSource(*job.src); err != nil {
+			return fmt.Errorf("failed to record source %s: %v", job.path, err)
+		}
+	}
+	p.recordSource(job.src)
+	return nil
+}
+
+// commitTables writes the tables read from a file
+func (p *Processor) commitTables(job *loadJob, reload bool) error {
+	if len(job.tables) == 0 {
+		return fmt.Errorf("no tables found in file: %s", job.path)
+	}
+
+	job.progress.setState(stateWriting)
+	for i, t := range job.tables {
+		name := job.tableName
+		if t.Name != "" {
+			name = job.tableName + "_" + utils.SanitizeColumnName(t.Name)
+		}
+		t.Meta.Source = job.path
+		summary, err := p.loadTable(name, t, reload, job.progress)
+		if err != nil {
+			return err
+		}
+		if i < len(job.parseTime) {
+			summary.Duration += job.parseTime[i]
+		}
+		job.results = append(job.results, summary)
+		job.src.Tables = append(job.src.Tables, name)
 	}
+	return nil
+}
 
+// commitDatabase runs a SQL script or attaches a database. Tables a
+// previous load of the same file brought in are replaced, kept for the
+// script to add to, or refused according to the import policy; a database
+// attached before is attached again.
+func (p *Processor) commitDatabase(job *loadJob, loader DatabaseLoader, reload bool) error {
+	previous, err := p.previousTables(job.path)
 	if err != nil {
 		return err
 	}
 
-	if len(data) < 1 {
-		return fmt.Errorf("no data found in file: %s", filePath)
+	policy := p.cfg.ImportPolicy
+	if reload {
+		policy = config.PolicyReplace
+	}
+	attached, err := p.dbManager.AttachedSchemas()
+	if err != nil {
+		return err
+	}
+	var existing, schemas []string
+	for _, table := range previous {
+		if schema, _, ok := strings.Cut(table, "."); ok {
+			if slices.Contains(attached, schema) && !slices.Contains(schemas, schema) {
+				schemas = append(schemas, schema)
+			}
+			continue
+		}
+		if exists, err := p.dbManager.TableExists(table); err != nil {
+			return err
+		} else if exists {
+			existing = append(existing, table)
+		}
+	}
+	if policy == config.PolicyFail && len(existing)+len(schemas) > 0 {
+		return fmt.Errorf("%s was already loaded, use --replace or --append to load it again", job.path)
 	}
 
-	if err := p.dbManager.CreateAndInsert(tableName, data); err != nil {
-		return fmt.Errorf("failed to load data into table %s: %v", tableName, err)
+	for _, schema := range schemas {
+		if err := p.dbManager.DetachDatabase(schema); err != nil {
+			return err
+		}
+	}
+	var kept []string
+	for _, table := range existing {
+		if policy == config.PolicyAppend {
+			kept = append(kept, table)
+		} else if err := p.dbManager.DropTable(table); err != nil {
+			return err
+		}
 	}
 
-	fmt.Printf("Successfully loaded table '%s' from %s.\n", tableName, filePath)
+	tables, err := loader.Load(job.localPath, job.tableName, p.dbManager, p.out)
+	if err != nil {
+		return err
+	}
+	job.src.Tables = append(kept, tables...)
 	return nil
 }
 
-// readCSV reads all records from a CSV file
-func (p *Processor) readCSV(filePath string) ([][]string, error) {
-	return ReadCSV(filePath)
+// previousTables returns the tables recorded for a file or URL by an
+// earlier load, in this session or into the database
+func (p *Processor) previousTables(path string) ([]string, error) {
+	for _, src := range p.sources {
+		if src.Path == path {
+			return src.Tables, nil
+		}
+	}
+	recorded, _, err := p.dbManager.LookupSource(path)
+	return recorded.Tables, err
+}
+
+// cleanup removes a temporary download. An attached database keeps reading
+// from its file, so a downloaded database that was loaded is kept until
+// Close.
+func (p *Processor) cleanup(job *loadJob, loaded bool) {
+	if job.localPath == job.path {
+		return
+	}
+	if attached, _ := IsSQLiteFile(job.localPath); attached && loaded {
+		p.attached = append(p.attached, job.localPath)
+		return
+	}
+	os.Remove(job.localPath)
 }
 
-// readXLSX reads all records from the first sheet of an Excel file
-func (p *Processor) readXLSX(filePath string) ([][]string, error) {
-	return ReadXLSX(filePath)
+// Close removes the downloaded databases kept while attached. It is called
+// once the database is closed.
+func (p *Processor) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var errs []error
+	for _, filePath := range p.attached {
+		if err := os.Remove(filePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			errs = append(errs, err)
+		}
+	}
+	p.attached = nil
+	return errors.Join(errs...)
+}
+
+// upToDate reports whether the database already holds the tables of an
+// unchanged source file, filling in their names
+func (p *Processor) upToDate(src *database.SourceRecord) (bool, error) {
+	recorded, found, err := p.dbManager.LookupSource(src.Path)
+	if err != nil || !found || recorded.Hash != src.Hash {
+		return false, err
+	}
+	for _, name := range recorded.Tables {
+		exists, err := p.dbManager.TableExists(name)
+		if err != nil || !exists {
+			return false, err
+		}
+	}
+	src.Tables = recorded.Tables
+	return true, nil
+}
+
+// loadTable creates a table from the records of t and stores its rejects.
+// An existing table is replaced, appended to or kept according to the
+// import policy; a reload always replaces it.
+func (p *Processor) loadTable(tableName string, t *Table, reload bool, prog *progress) (TableSummary, error) {
+	summary := TableSummary{Table: tableName, Source: t.Meta.Source}
+	start := time.Now()
+
+	// Two files of the same name in different directories are an error
+	// rather than one replacing the other
+	if source, ok := p.batch[tableName]; ok && source != t.Meta.Source {
+		return summary, fmt.Errorf("table %s is already loaded from %s, rename %s to load both", tableName, source, t.Meta.Source)
+	}
+
+	exists, err := p.dbManager.TableExists(tableName)
+	if err != nil {
+		return summary, err
+	}
+
+	policy := p.cfg.ImportPolicy
+	if reload {
+		policy = config.PolicyReplace
+	}
+
+	records := countRecords(t.Records, &prog.written, &summary.Columns)
+	action := "loaded"
+	switch {
+	case !exists:
+		summary.Rows, err = p.dbManager.CreateAndInsertRows(tableName, records)
+	case policy == config.PolicyReplace:
+		action = "replaced"
+		summary.Rows, err = p.dbManager.ReplaceAndInsertRows(tableName, records)
+		if err == nil {
+			err = p.dbManager.ClearRejects(tableName)
+		}
+	case policy == config.PolicyAppend:
+		summary.Rows, err = p.dbManager.AppendRows(tableName, records)
+		action = fmt.Sprintf("appended %d rows to", summary.Rows)
+	default:
+		return summary, fmt.Errorf("table %s already exists, use --replace or --append to update it from %s", tableName, t.Meta.Source)
+	}
+	if err != nil {
+		if errors.Is(err, database.ErrEmptyData) {
+			return summary, fmt.Errorf("no data found in file: %s", t.Meta.Source)
+		}
+		return summary, fmt.Errorf("failed to load data into table %s: %v", tableName, err)
+	}
+	summary.Duration = time.Since(start)
+	if p.batch != nil {
+		p.batch[tableName] = t.Meta.Source
+	}
+
+	fmt.Fprintf(p.out, "Successfully %s table '%s' from %s.\n", action, tableName, t.Meta.Source)
+
+	return summary, p.reportRejects(tableName, t.Meta.Source, t.Meta.Rejects)
+}
+
+// reportRejects stores rejected rows and prints a short summary of them
+func (p *Processor) reportRejects(tableName, source string, rejects []database.Reject) error {
+	if len(rejects) == 0 {
+		return nil
+	}
+
+	if err := p.dbManager.RecordRejects(tableName, source, rejects); err != nil {
+		return fmt.Errorf("failed to record rejected rows for table %s: %v", tableName, err)
+	}
+
+	// Only the log readers drop rows; the lenient CSV reader repairs them all
+	skipped := 0
+	for _, r := range rejects {
+		if r.Skipped {
+			skipped++
+		}
+	}
+	var counts []string
+	if repaired := len(rejects) - skipped; repaired > 0 {
+		counts = append(counts, fmt.Sprintf("%d rows repaired", repaired))
+	}
+	if skipped > 0 {
+		counts = append(counts, fmt.Sprintf("%d rows skipped", skipped))
+	}
+	fmt.Fprintf(p.out, "  %s; see table %s for details.\n", strings.Join(counts, ", "), database.RejectsTable)
+	return nil
 }
@@ -0,0 +1,249 @@
+package importer
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"csvsql/config"
+	"csvsql/internal/database"
+	"csvsql/internal/mapping"
+)
+
+// newTestProcessor creates a processor writing to an in-memory database
+func newTestProcessor(t *testing.T) (*Processor, *database.Manager) {
+	t.Helper()
+	db, err := sql.Open(database.DriverName, ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	dbManager := database.NewManager(db, mapping.NewMapper())
+	cfg := &config.Config{ImportPolicy: config.PolicyReplace}
+	processor := NewProcessor(dbManager, cfg)
+	processor.out = io.Discard
+	return processor, dbManager
+}
+
+func TestLoadFiles(t *testing.T) {
+	processor, _ := newTestProcessor(t)
+	orders := writeTempFile(t, "orders.csv", "id,客户,amount\n1,a,10\n2,b,20\n3,c,30\n")
+	items := writeTempFile(t, "items.csv", "sku,name\nx,pen\n")
+	missing := filepath.Join(t.TempDir(), "missing.csv")
+
+	results := processor.LoadFiles([]string{orders, missing, items})
+	if len(results) != 3 {
+		t.Fatalf("LoadFiles() returned %d results, want 3", len(results))
+	}
+
+	want := []struct {
+		path  string
+		table string
+		rows  int
+		cols  int
+	}{
+		{orders, "orders", 3, 3},
+		{missing, "", 0, 0},
+		{items, "items", 1, 2},
+	}
+	for i, w := range want {
+		result := results[i]
+		if result.Path != w.path {
+			t.Errorf("result %d path = %q, want %q", i, result.Path, w.path)
+		}
+		if w.table == "" {
+			if result.Err == nil {
+				t.Errorf("result %d: expected an error for a missing file", i)
+			}
+			continue
+		}
+		if result.Err != nil {
+			t.Errorf("result %d error = %v", i, result.Err)
+			continue
+		}
+		if len(result.Tables) != 1 {
+			t.Fatalf("result %d has %d tables, want 1", i, len(result.Tables))
+		}
+		got := result.Tables[0]
+		if got.Table != w.table || got.Rows != w.rows || got.Columns != w.cols {
+			t.Errorf("result %d = %s with %d rows and %d columns, want %s with %d rows and %d columns",
+				i, got.Table, got.Rows, got.Columns, w.table, w.rows, w.cols)
+		}
+	}
+
+	// More files than are read ahead are all loaded, in order
+	var many []string
+	for i := range 3 * maxReadAhead {
+		many = append(many, writeTempFile(t, fmt.Sprintf("part%d.csv", i), fmt.Sprintf("n\n%d\n", i)))
+	}
+	for i, result := range processor.LoadFiles(many) {
+		if want := fmt.Sprintf("part%d", i); result.Err != nil || len(result.Tables) != 1 || result.Tables[0].Table != want {
+			t.Errorf("result %d = %+v, want table %s", i, result, want)
+		}
+	}
+}
+
+func TestImportUpsert(t *testing.T) {
+	processor, dbManager := newTestProcessor(t)
+	base := writeTempFile(t, "base.csv", "id,姓名,score\n1,张三,80\n2,李四,70\n")
+	delta := writeTempFile(t, "delta.csv", "score,id,城市\n95,2,北京\n60,3,上海\n")
+
+	if err := processor.LoadFile(base); err != nil {
+		t.Fatal(err)
+	}
+	result, err := processor.Import(delta, "base", "id")
+	if err != nil {
+		t.Fatalf("Import() error = %v", err)
+	}
+	if result.Inserted != 1 || result.Updated != 1 {
+		t.Errorf("Import() inserted %d and updated %d rows, want 1 and 1", result.Inserted, result.Updated)
+	}
+	if !reflect.DeepEqual(result.AddedColumns, []string{"城市"}) {
+		t.Errorf("Import() added columns %v, want [城市]", result.AddedColumns)
+	}
+
+	got, err := dbManager.ExecuteQuery(context.Background(), "SELECT id, 姓名, score, 城市 FROM base ORDER BY id;")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"id", "姓名", "score", "城市"},
+		{"1", "张三", "80", "NULL"},
+		{"2", "李四", "95", "北京"},
+		{"3", "NULL", "60", "上海"},
+	}
+	if !reflect.DeepEqual(got.Table("NULL"), want) {
+		t.Errorf("table after import = %v, want %v", got.Table("NULL"), want)
+	}
+
+	// The key is only indexed while the merge runs
+	indexes, err := dbManager.ExecuteQuery(context.Background(), "SELECT count(*) FROM sqlite_master WHERE type = 'index';")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := indexes.Table("")[1][0]; n != "0" {
+		t.Errorf("%s indexes left after the import, want none", n)
+	}
+
+	if _, err := processor.Import(delta, "base", "missing"); err == nil {
+		t.Error("Import() with an unknown key column should fail")
+	}
+}
+
+func TestNullTokens(t *testing.T) {
+	processor, dbManager := newTestProcessor(t)
+	dbManager.SetNullTokens([]string{"", "NA", "无"})
+	filePath := writeTempFile(t, "scores.csv", "name,score,note\na,NA,无\nb,,NULL\nc,1,\n")
+
+	if err := processor.LoadFile(filePath); err != nil {
+		t.Fatal(err)
+	}
+	got, err := dbManager.ExecuteQuery(context.Background(), "SELECT name, score IS NULL, note IS NULL FROM scores;")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"name", "score IS NULL", "note IS NULL"},
+		{"a", "1", "1"},
+		{"b", "1", "0"},
+		{"c", "0", "1"},
+	}
+	if !reflect.DeepEqual(got.Table(""), want) {
+		t.Errorf("NULL cells = %v, want %v", got.Table(""), want)
+	}
+}
+
+func TestCleanDateFormats(t *testing.T) {
+	processor, dbManager := newTestProcessor(t)
+	processor.cfg.Clean = "shipped:date;paid:date"
+	processor.cfg.DateFormats = []string{"02.01.2006"}
+	processor.cfg.TimeZone = "Asia/Shanghai"
+	filePath := writeTempFile(t, "orders.csv", "id,shipped,paid\n1,05.03.2024,2024-03-05 08:30:00\n")
+
+	if err := processor.LoadFile(filePath); err != nil {
+		t.Fatal(err)
+	}
+	got, err := dbManager.ExecuteQuery(context.Background(), "SELECT shipped, paid FROM orders;")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []any{"2024-03-05", "2024-03-05 08:30:00+08:00"}
+	if !reflect.DeepEqual(got.Rows[0], want) {
+		t.Errorf("cleaned dates = %v, want %v", got.Rows[0], want)
+	}
+}
+
+func TestImportPolicies(t *testing.T) {
+	tests := []struct {
+		policy  string
+		change  bool // whether the file changes before the second load
+		want    string
+		wantErr bool
+	}{
+		{config.PolicyAppend, false, "1", false}, // unchanged files are skipped
+		{config.PolicyReplace, true, "2", false},
+		{config.PolicyAppend, true, "1,2", false},
+		{config.PolicyFail, true, "1", true},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s changed=%v", tt.policy, tt.change), func(t *testing.T) {
+			processor, dbManager := newTestProcessor(t)
+			processor.cfg.ImportPolicy = tt.policy
+			filePath := writeTempFile(t, "data.csv", "n\n1\n")
+			if err := processor.LoadFile(filePath); err != nil {
+				t.Fatal(err)
+			}
+			if tt.change {
+				if err := os.WriteFile(filePath, []byte("n\n2\n"), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err := processor.LoadFile(filePath)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("second LoadFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			got, err := dbManager.ExecuteQuery(context.Background(), "SELECT group_concat(n) FROM data;")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rows := got.Table("NULL")[1][0]; rows != tt.want {
+				t.Errorf("rows = %s, want %s", rows, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadFilesSameName(t *testing.T) {
+	processor, dbManager := newTestProcessor(t)
+	first := writeTempFile(t, "data.csv", "n\n1\n")
+	second := writeTempFile(t, "data.csv", "n\n2\n")
+
+	// Files of one invocation cannot load the same table
+	results := processor.LoadFiles([]string{first, second})
+	if results[0].Err != nil {
+		t.Fatalf("first file error = %v", results[0].Err)
+	}
+	if results[1].Err == nil {
+		t.Error("second file with the same table name should fail")
+	}
+
+	// A later invocation replaces the table
+	if results := processor.LoadFiles([]string{second}); results[0].Err != nil {
+		t.Errorf("later LoadFiles() error = %v", results[0].Err)
+	}
+	got, err := dbManager.ExecuteQuery(context.Background(), "SELECT group_concat(n) FROM data;")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rows := got.Table("NULL")[1][0]; rows != "2" {
+		t.Errorf("rows = %s, want 2", rows)
+	}
+}
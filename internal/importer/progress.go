@@ -0,0 +1,189 @@
+package importer
+
+import (
+	"fmt"
+	"io"
+	"iter"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+
+	"csvsql/pkg/utils"
+)
+
+// progressInterval is how often the progress display is redrawn
+const progressInterval = 200 * time.Millisecond
+
+// progressBarWidth is the number of cells of a progress bar
+const progressBarWidth = 24
+
+// Import states shown by the progress display
+const (
+	stateWaiting int32 = iota
+	stateReading
+	stateWriting
+	stateDone
+	stateSkipped
+	stateFailed
+)
+
+var stateNames = []string{"waiting", "reading", "writing", "done", "up to date", "failed"}
+
+// progress tracks the import of one file. Its counters are updated by the
+// loading goroutines and read by the progress display.
+type progress struct {
+	name       string
+	state      atomic.Int32
+	stateSince atomic.Int64 // Unix nanoseconds of the last state change
+	read       atomic.Int64 // data rows read in advance
+	written    atomic.Int64 // data rows passed to the database
+}
+
+func newProgress(filePath string) *progress {
+	prog := &progress{name: filepath.Base(filePath)}
+	prog.stateSince.Store(time.Now().UnixNano())
+	return prog
+}
+
+func (prog *progress) setState(state int32) {
+	prog.state.Store(state)
+	prog.stateSince.Store(time.Now().UnixNano())
+}
+
+// finish sets the final state of an import
+func (prog *progress) finish(job *loadJob, err error) {
+	switch {
+	case err != nil:
+		prog.setState(stateFailed)
+	case job.upToDate:
+		prog.setState(stateSkipped)
+	default:
+		prog.setState(stateDone)
+	}
+}
+
+// line renders the progress of the file, its name padded to nameWidth
+func (prog *progress) line(nameWidth int) string {
+	state := prog.state.Load()
+	elapsed := time.Since(time.Unix(0, prog.stateSince.Load())).Seconds()
+	read, written := prog.read.Load(), prog.written.Load()
+
+	var fraction float64
+	rows := written
+	switch state {
+	case stateReading:
+		rows = read
+	case stateWriting:
+		// Files read in advance have a known row count while they are written
+		if read > 0 {
+			fraction = float64(written) / float64(read)
+		}
+	case stateDone, stateSkipped:
+		fraction = 1
+	}
+
+	filled := int(fraction * progressBarWidth)
+	bar := strings.Repeat("#", filled) + strings.Repeat("-", progressBarWidth-filled)
+	name := prog.name + strings.Repeat(" ", max(nameWidth-utils.StringWidth(prog.name), 0))
+
+	status := fmt.Sprintf("%s [%s] %3.0f%%  %d rows", name, bar, fraction*100, rows)
+	if (state == stateReading || state == stateWriting) && elapsed > 0 {
+		status += fmt.Sprintf("  %.0f rows/s", float64(rows)/elapsed)
+	}
+	return status + "  " + stateNames[state]
+}
+
+// progressDisplay redraws a progress bar per file on a terminal until stopped
+type progressDisplay struct {
+	w     io.Writer
+	files []*progress
+	lines int
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+func startProgress(w io.Writer, files []*progress) *progressDisplay {
+	d := &progressDisplay{w: w, files: files, stop: make(chan struct{}), done: make(chan struct{})}
+	go func() {
+		defer close(d.done)
+		ticker := time.NewTicker(progressInterval)
+		defer ticker.Stop()
+		for {
+			d.render()
+			select {
+			case <-d.stop:
+				d.render()
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return d
+}
+
+// Stop draws the final state and stops redrawing
+func (d *progressDisplay) Stop() {
+	close(d.stop)
+	<-d.done
+}
+
+func (d *progressDisplay) render() {
+	nameWidth := 0
+	for _, prog := range d.files {
+		nameWidth = max(nameWidth, utils.StringWidth(prog.name))
+	}
+
+	var b strings.Builder
+	if d.lines > 0 {
+		// Move back to the first line of the previous drawing
+		fmt.Fprintf(&b, "\033[%dA", d.lines)
+	}
+	for _, prog := range d.files {
+		fmt.Fprintf(&b, "\r\033[K%s\n", prog.line(nameWidth))
+	}
+	d.lines = len(d.files)
+	io.WriteString(d.w, b.String())
+}
+
+// countRecords passes records through, adding the number of data rows to
+// counter and storing the width of the header in columns if not nil
+func countRecords(records iter.Seq2[[]string, error], counter *atomic.Int64, columns *int) iter.Seq2[[]string, error] {
+	return func(yield func([]string, error) bool) {
+		header := true
+		for record, err := range records {
+			if err == nil {
+				if header {
+					if columns != nil {
+						*columns = len(record)
+					}
+					header = false
+				} else {
+					counter.Add(1)
+				}
+			}
+			if !yield(record, err) {
+				return
+			}
+		}
+	}
+}
+
+// PrintSummary writes the rows, columns and load time of every table loaded
+func PrintSummary(w io.Writer, results []LoadResult) {
+	var tables []TableSummary
+	for _, result := range results {
+		tables = append(tables, result.Tables...)
+	}
+	if len(tables) == 0 {
+		return
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "table\trows\tcolumns\ttime")
+	for _, t := range tables {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%s\n", t.Table, t.Rows, t.Columns, t.Duration.Round(time.Millisecond))
+	}
+	tw.Flush()
+}
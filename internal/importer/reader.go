@@ -0,0 +1,87 @@
+package importer
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"iter"
+
+	"csvsql/internal/database"
+	"csvsql/pkg/format"
+)
+
+// The types of input formats are defined in package format, so that
+// programs embedding csvsql can add their own
+type (
+	Reader   = format.Reader
+	Table    = format.Table
+	Metadata = format.Metadata
+	Registry = format.Registry
+)
+
+// DatabaseLoader is implemented by readers whose files are applied to the
+// database directly instead of producing tables, such as SQLite databases
+// and SQL scripts. Load returns the tables the file brought in, those of
+// attached databases qualified with their schema, e.g. sales.orders, and
+// reports what it did to out.
+type DatabaseLoader interface {
+	Load(filePath, name string, dbManager *database.Manager, out io.Writer) ([]string, error)
+}
+
+// Builtins holds the built-in readers
+var Builtins = format.NewRegistry(
+	csvFormat{},
+	xlsxFormat{},
+	fixedWidthFormat{},
+	logFormat{},
+	xmlFormat{},
+	htmlFormat{},
+	markdownFormat{},
+	sqliteFormat{},
+	sqlScriptFormat{},
+)
+
+// sliceRecords yields the records of an in-memory table
+func sliceRecords(data [][]string) iter.Seq2[[]string, error] {
+	return func(yield func([]string, error) bool) {
+		for _, record := range data {
+			if !yield(record, nil) {
+				return
+			}
+		}
+	}
+}
+
+// collectRecords reads all records of a table into memory
+func collectRecords(t *Table) ([][]string, error) {
+	var data [][]string
+	for record, err := range t.Records {
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, record)
+	}
+	return data, nil
+}
+
+// numberedTables wraps the tables of a document, numbering them when there is more than one
+func numberedTables(formatName, filePath string, tables [][][]string) []*Table {
+	result := make([]*Table, len(tables))
+	for i, data := range tables {
+		t := &Table{
+			Records: sliceRecords(data),
+			Meta:    Metadata{Format: formatName, Source: filePath},
+		}
+		if len(tables) > 1 {
+			t.Name = fmt.Sprintf("%d", i+1)
+			t.Meta.Detail = fmt.Sprintf("table %d", i+1)
+		}
+		result[i] = t
+	}
+	return result
+}
+
+// trimHead strips a UTF-8 byte order mark and leading whitespace from sniffed bytes
+func trimHead(head []byte) []byte {
+	return bytes.TrimLeft(bytes.TrimPrefix(head, []byte("\xef\xbb\xbf")), " \t\r\n")
+}
@@ -0,0 +1,76 @@
+package importer
+
+import (
+	"testing"
+
+	"csvsql/pkg/format"
+)
+
+// tsvFormat is a custom reader used to check registry precedence
+type tsvFormat struct{ csvFormat }
+
+func (tsvFormat) Name() string         { return "custom" }
+func (tsvFormat) Extensions() []string { return []string{".csv", ".tsv"} }
+
+func (tsvFormat) Tables(filePath string, opts format.Options) ([]*Table, error) {
+	return nil, nil
+}
+
+// noteFormat is a custom reader added with format.Register
+type noteFormat struct{ tsvFormat }
+
+func (noteFormat) Name() string         { return "note" }
+func (noteFormat) Extensions() []string { return []string{".note"} }
+
+func TestRegistryLookup(t *testing.T) {
+	registry := format.NewRegistry(Builtins.Readers()...)
+
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		opts    format.Options
+		want    string
+	}{
+		{"extension", "data.csv", "a,b\n1,2\n", format.Options{}, "csv"},
+		{"upper case extension", "DATA.XLSX", "", format.Options{}, "xlsx"},
+		{"sqlite magic", "reference.bin", "SQLite format 3\x00rest", format.Options{}, "sqlite"},
+		{"xml prolog", "export", "\xef\xbb\xbf  <?xml version=\"1.0\"?><a/>", format.Options{}, "xml"},
+		{"html doctype", "page", "<!DOCTYPE html><html></html>", format.Options{}, "html"},
+		{"txt with a column spec", "statement.txt", "2024-01-01 100", format.Options{FixedSpec: "date:1-10"}, "fixed-width"},
+		{"txt without a column spec", "page.txt", "<!DOCTYPE html><html></html>", format.Options{}, "html"},
+		{"dat without a column spec", "statement.dat", "", format.Options{}, "fixed-width"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader, err := registry.Lookup(writeTempFile(t, tt.file, tt.content), tt.opts)
+			if err != nil {
+				t.Fatalf("Lookup() error = %v", err)
+			}
+			if reader.Name() != tt.want {
+				t.Errorf("Lookup() = %s, want %s", reader.Name(), tt.want)
+			}
+		})
+	}
+
+	for _, file := range []string{"notes.unknown", "notes.txt"} {
+		if _, err := registry.Lookup(writeTempFile(t, file, "hello"), format.Options{}); err == nil {
+			t.Errorf("Lookup(%s) expected an error for an unknown format", file)
+		}
+	}
+
+	// Readers registered later take precedence over built-in ones
+	registry.Register(tsvFormat{})
+	reader, err := registry.Lookup(writeTempFile(t, "data.csv", "a,b\n"), format.Options{})
+	if err != nil || reader.Name() != "custom" {
+		t.Errorf("Lookup() after Register = %v, %v, want custom reader", reader, err)
+	}
+
+	// Processors created after format.Register use the reader
+	format.Register(noteFormat{})
+	processor, _ := newTestProcessor(t)
+	reader, err = processor.registry.Lookup(writeTempFile(t, "todo.note", ""), format.Options{})
+	if err != nil || reader.Name() != "note" {
+		t.Errorf("processor Lookup() after format.Register = %v, %v, want note reader", reader, err)
+	}
+}
@@ -0,0 +1,154 @@
+package importer
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"csvsql/pkg/utils"
+)
+
+// contentTypeExtensions maps media types to the file extension of their reader
+var contentTypeExtensions = map[string]string{
+	"text/csv":                    ".csv",
+	"application/csv":             ".csv",
+	"text/comma-separated-values": ".csv",
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet": ".xlsx",
+	"text/html":               ".html",
+	"application/xhtml+xml":   ".html",
+	"text/xml":                ".xml",
+	"application/xml":         ".xml",
+	"text/markdown":           ".md",
+	"application/sql":         ".sql",
+	"application/vnd.sqlite3": ".db",
+	"application/x-sqlite3":   ".db",
+}
+
+// downloadTimeout bounds a whole download, so that a server that stops
+// answering fails the import instead of hanging startup
+const downloadTimeout = 5 * time.Minute
+
+// httpClient is used for all downloads
+var httpClient = &http.Client{Timeout: downloadTimeout}
+
+// IsURL reports whether a command-line argument is an HTTP(S) URL rather than a file path
+func IsURL(arg string) bool {
+	lower := strings.ToLower(arg)
+	return strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://")
+}
+
+// URLTableName derives a table name from the last element of a URL path,
+// falling back to the host name
+func URLTableName(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return utils.SanitizeTableName(rawURL)
+	}
+	base := path.Base(u.Path)
+	name := strings.TrimSuffix(base, path.Ext(base))
+	if name == "" || name == "." || name == "/" {
+		name = u.Hostname()
+	}
+	return utils.SanitizeTableName(name)
+}
+
+// Download fetches a URL into a temporary file and returns its path. The
+// file gets an extension matching the Content-Type or, for generic types,
+// the extension of the URL path, so that the registry can pick a reader. Compressed
+// responses are decoded, and downloads larger than maxSize bytes (after
+// decoding) are rejected. The caller removes the file.
+func Download(rawURL string, maxSize int64) (string, error) {
+	req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	if err != nil {
+		return "", err
+	}
+	// Asking explicitly disables transparent decoding, so every encoding is handled below
+	req.Header.Set("Accept-Encoding", "gzip, deflate")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return "", fmt.Errorf("download %s failed: %s", rawURL, resp.Status)
+	}
+
+	if maxSize > 0 && resp.ContentLength > maxSize {
+		return "", fmt.Errorf("download %s is %d bytes, larger than the limit of %d bytes", rawURL, resp.ContentLength, maxSize)
+	}
+
+	body, err := decodeBody(resp)
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+
+	file, err := os.CreateTemp("", "csvsql-*"+downloadExtension(rawURL, resp.Header.Get("Content-Type")))
+	if err != nil {
+		return "", err
+	}
+
+	src := io.Reader(body)
+	if maxSize > 0 {
+		src = io.LimitReader(body, maxSize+1)
+	}
+	n, err := io.Copy(file, src)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && maxSize > 0 && n > maxSize {
+		err = fmt.Errorf("download %s is larger than the limit of %d bytes", rawURL, maxSize)
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+
+	return file.Name(), nil
+}
+
+// decodeBody wraps a response body according to its Content-Encoding
+func decodeBody(resp *http.Response) (io.ReadCloser, error) {
+	switch strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding"))) {
+	case "", "identity":
+		return io.NopCloser(resp.Body), nil
+	case "gzip", "x-gzip":
+		return gzip.NewReader(resp.Body)
+	case "deflate":
+		// HTTP deflate is zlib-wrapped, but some servers send raw deflate data
+		br := bufio.NewReader(resp.Body)
+		header, err := br.Peek(2)
+		if err == nil && header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+			return zlib.NewReader(br)
+		}
+		return flate.NewReader(br), nil
+	default:
+		return nil, fmt.Errorf("unsupported Content-Encoding: %s", resp.Header.Get("Content-Encoding"))
+	}
+}
+
+// downloadExtension picks the extension for a downloaded file: a specific
+// Content-Type wins, otherwise the extension of the URL path is kept
+func downloadExtension(rawURL, contentType string) string {
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		if ext, ok := contentTypeExtensions[mediaType]; ok {
+			return ext
+		}
+	}
+	if u, err := url.Parse(rawURL); err == nil {
+		return strings.ToLower(path.Ext(u.Path))
+	}
+	return ""
+}
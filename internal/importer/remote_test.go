@@ -0,0 +1,154 @@
+package importer
+
+import (
+	"bytes"
+	"compress/gzip"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"csvsql/internal/database"
+)
+
+func TestDownload(t *testing.T) {
+	const content = "id,名称\n1,a\n2,b\n"
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/reports/daily.csv", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(content))
+	})
+	mux.HandleFunc("/export", func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			t.Errorf("request does not accept gzip: %q", r.Header.Get("Accept-Encoding"))
+		}
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		zw.Write([]byte(content))
+		zw.Close()
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write(buf.Bytes())
+	})
+	mux.HandleFunc("/missing.csv", http.NotFound)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		path    string
+		maxSize int64
+		wantExt string
+		wantErr bool
+	}{
+		{"extension from path", "/reports/daily.csv", 0, ".csv", false},
+		{"gzip with content type", "/export?day=1", 0, ".csv", false},
+		{"not found", "/missing.csv", 0, "", true},
+		{"too large", "/reports/daily.csv", 8, "", true},
+		{"too large after decoding", "/export", 8, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			localPath, err := Download(server.URL+tt.path, tt.maxSize)
+			if tt.wantErr {
+				if err == nil {
+					os.Remove(localPath)
+					t.Fatalf("Download() expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Download() error = %v", err)
+			}
+			defer os.Remove(localPath)
+
+			if ext := filepath.Ext(localPath); ext != tt.wantExt {
+				t.Errorf("Download() extension = %q, want %q", ext, tt.wantExt)
+			}
+			got, err := os.ReadFile(localPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != content {
+				t.Errorf("Download() content = %q, want %q", got, content)
+			}
+		})
+	}
+}
+
+func TestURLTableName(t *testing.T) {
+	tests := map[string]string{
+		"http://reports.intranet/daily.csv":         "daily",
+		"https://example.com/a/b/2024-03 sales.csv": "_202403sales",
+		"http://reports.intranet/":                  "reportsintranet",
+		"http://host/export?id=3":                   "export",
+	}
+	for rawURL, want := range tests {
+		if got := URLTableName(rawURL); got != want {
+			t.Errorf("URLTableName(%q) = %q, want %q", rawURL, got, want)
+		}
+	}
+}
+
+func TestDownloadStalled(t *testing.T) {
+	stalled := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-stalled:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(stalled)
+
+	client := httpClient
+	httpClient = &http.Client{Timeout: 50 * time.Millisecond}
+	defer func() { httpClient = client }()
+
+	if localPath, err := Download(server.URL+"/daily.csv", 0); err == nil {
+		os.Remove(localPath)
+		t.Error("Download() from a server that does not answer should time out")
+	}
+}
+
+func TestAttachedDownloadRemoved(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "archive.db")
+	db, err := sql.Open(database.DriverName, dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec("CREATE TABLE orders (id INTEGER); INSERT INTO orders VALUES (1);")
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/vnd.sqlite3")
+		http.ServeFile(w, r, dbPath)
+	}))
+	defer server.Close()
+
+	processor, dbManager := newTestProcessor(t)
+	if err := processor.LoadFile(server.URL + "/archive"); err != nil {
+		t.Fatal(err)
+	}
+	if len(processor.attached) != 1 {
+		t.Fatalf("kept downloads = %v, want the attached database", processor.attached)
+	}
+	downloaded := processor.attached[0]
+	if _, err := os.Stat(downloaded); err != nil {
+		t.Fatalf("attached download removed too early: %v", err)
+	}
+
+	dbManager.Close()
+	if err := processor.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if _, err := os.Stat(downloaded); !os.IsNotExist(err) {
+		t.Errorf("attached download %s still exists after Close()", downloaded)
+	}
+}
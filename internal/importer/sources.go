@@ -0,0 +1,182 @@
+package importer
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"csvsql/internal/database"
+	"csvsql/pkg/utils"
+)
+
+// statSource describes the current state of a local file
+func statSource(filePath string) (*database.SourceRecord, error) {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return nil, err
+	}
+	hash, err := utils.FileHash(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return &database.SourceRecord{Path: filePath, Size: info.Size(), ModTime: info.ModTime(), Hash: hash}, nil
+}
+
+// recordSource remembers src, dropping tables a previous load of the same
+// path created but the new one did not. Tables of attached databases go
+// with their file.
+func (p *Processor) recordSource(src *database.SourceRecord) {
+	for i, old := range p.sources {
+		if old.Path != src.Path {
+			continue
+		}
+		for _, table := range old.Tables {
+			if !slices.Contains(src.Tables, table) && !strings.Contains(table, ".") {
+				if err := p.dbManager.DropTable(table); err != nil {
+					fmt.Fprintf(p.out, "Warning: failed to drop stale table %s: %v\n", table, err)
+				}
+			}
+		}
+		p.sources[i] = src
+		return
+	}
+	p.sources = append(p.sources, src)
+}
+
+// Sources returns the files and URLs tables were loaded from
+func (p *Processor) Sources() []database.SourceRecord {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	result := make([]database.SourceRecord, len(p.sources))
+	for i, src := range p.sources {
+		result[i] = *src
+		result[i].Tables = slices.Clone(src.Tables)
+	}
+	return result
+}
+
+// Reload re-imports a table from its recorded source, replacing the table
+// and rebuilding its mappings; with an empty name every source is reloaded.
+// All tables of a multi-table source are reloaded together.
+func (p *Processor) Reload(tableName string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var paths []string
+	for _, src := range p.sources {
+		if tableName == "" || slices.Contains(src.Tables, tableName) {
+			paths = append(paths, src.Path)
+		}
+	}
+	if len(paths) == 0 {
+		if tableName == "" {
+			return fmt.Errorf("no tables were loaded from files")
+		}
+		return fmt.Errorf("no source file recorded for table %s", tableName)
+	}
+
+	var errs []string
+	for _, path := range paths {
+		if err := p.loadSource(path, true); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("reload failed: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Open switches the database to the workspace kept in a SQLite file. The
+// sources loaded into the previous workspace are forgotten, so they are
+// neither reloaded nor watched into the new one. A reload in progress
+// finishes first.
+func (p *Processor) Open(filePath string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := p.dbManager.Open(filePath); err != nil {
+		return err
+	}
+	p.sources = nil
+	return nil
+}
+
+// defaultWatchInterval is how often Watch polls when given no interval
+const defaultWatchInterval = 2 * time.Second
+
+// Watch polls the recorded source files every interval and reloads those
+// whose content changed, until stop is closed. notify receives a message
+// for every reload. URLs are not watched. An interval that is not positive
+// is replaced by defaultWatchInterval.
+func (p *Processor) Watch(interval time.Duration, stop <-chan struct{}, notify func(message string)) {
+	if interval <= 0 {
+		interval = defaultWatchInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			for _, message := range p.reloadChanged() {
+				notify(message)
+			}
+		}
+	}
+}
+
+// reloadChanged reloads every local source whose content differs from the
+// recorded state and returns a message per reload. Nothing is reloaded
+// while a transaction begun with BEGIN is open; the change is picked up by
+// the first poll after it ends.
+func (p *Processor) reloadChanged() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.dbManager.InTransaction() {
+		return nil
+	}
+
+	var messages []string
+	for _, src := range slices.Clone(p.sources) {
+		if IsURL(src.Path) {
+			continue
+		}
+		info, err := os.Stat(src.Path)
+		if err != nil || (info.Size() == src.Size && info.ModTime().Equal(src.ModTime)) {
+			continue
+		}
+
+		// A new modification time alone, e.g. after touch, does not trigger a reload
+		hash, err := utils.FileHash(src.Path)
+		if err != nil {
+			continue
+		}
+		if hash == src.Hash {
+			src.Size, src.ModTime = info.Size(), info.ModTime()
+			continue
+		}
+
+		var out bytes.Buffer
+		previous := p.out
+		p.out = &out
+		err = p.loadSource(src.Path, true)
+		p.out = previous
+
+		if err != nil {
+			// Remember the new state so a broken file is not retried on every poll
+			src.Size, src.ModTime, src.Hash = info.Size(), info.ModTime(), hash
+			messages = append(messages, fmt.Sprintf("[watch] %s changed but could not be reloaded: %v", src.Path, err))
+			continue
+		}
+		messages = append(messages, fmt.Sprintf("[watch] %s changed, reloaded:\n%s", src.Path, strings.TrimRight(out.String(), "\n")))
+	}
+	return messages
+}
@@ -0,0 +1,190 @@
+package importer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReload(t *testing.T) {
+	processor, dbManager := newTestProcessor(t)
+	filePath := writeTempFile(t, "people.csv", "姓名,age\n张三,30\n")
+	if err := processor.LoadFile(filePath); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filePath, []byte("城市,age\n北京,1\n上海,2\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := processor.Reload("people"); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	got, err := dbManager.ExecuteQuery(context.Background(), "SELECT 城市 FROM people ORDER BY age;")
+	if err != nil {
+		t.Fatalf("query of the new header error = %v", err)
+	}
+	if want := [][]string{{"城市"}, {"北京"}, {"上海"}}; !reflect.DeepEqual(got.Table(""), want) {
+		t.Errorf("reloaded table = %v, want %v", got.Table(""), want)
+	}
+
+	// The mappings of the old header are replaced, not merged
+	if want := map[string]string{"城市": "_1"}; !reflect.DeepEqual(dbManager.GetMapper().GetTableMappings("people"), want) {
+		t.Errorf("mappings after Reload() = %v, want %v", dbManager.GetMapper().GetTableMappings("people"), want)
+	}
+
+	if err := processor.Reload("missing"); err == nil {
+		t.Error("Reload() of a table without a source should fail")
+	}
+}
+
+func TestReloadChanged(t *testing.T) {
+	processor, dbManager := newTestProcessor(t)
+	filePath := writeTempFile(t, "scores.csv", "n\n1\n")
+	if err := processor.LoadFile(filePath); err != nil {
+		t.Fatal(err)
+	}
+	rows := func() string {
+		t.Helper()
+		got, err := dbManager.ExecuteQuery(context.Background(), "SELECT group_concat(n) FROM scores;")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return got.Table("NULL")[1][0]
+	}
+
+	if messages := processor.reloadChanged(); len(messages) != 0 {
+		t.Errorf("reloadChanged() of an unchanged file = %q, want none", messages)
+	}
+
+	// A new modification time alone does not reload the file
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(filePath, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if messages := processor.reloadChanged(); len(messages) != 0 {
+		t.Errorf("reloadChanged() of a touched file = %q, want none", messages)
+	}
+
+	if err := os.WriteFile(filePath, []byte("n\n1\n2\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	messages := processor.reloadChanged()
+	if len(messages) != 1 || !strings.Contains(messages[0], "changed, reloaded") {
+		t.Errorf("reloadChanged() of a changed file = %q, want one reload", messages)
+	}
+	if got := rows(); got != "1,2" {
+		t.Errorf("rows after the reload = %s, want 1,2", got)
+	}
+
+	// A file that cannot be loaded is reported once and the table kept
+	if err := os.WriteFile(filePath, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	messages = processor.reloadChanged()
+	if len(messages) != 1 || !strings.Contains(messages[0], "could not be reloaded") {
+		t.Errorf("reloadChanged() of a broken file = %q, want one failure", messages)
+	}
+	if messages := processor.reloadChanged(); len(messages) != 0 {
+		t.Errorf("reloadChanged() retried a broken file: %q", messages)
+	}
+	if got := rows(); got != "1,2" {
+		t.Errorf("rows after a failed reload = %s, want 1,2", got)
+	}
+
+	// Nothing is reloaded inside a transaction begun with BEGIN
+	if _, err := dbManager.ExecuteQuery(context.Background(), "BEGIN"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filePath, []byte("n\n3\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if messages := processor.reloadChanged(); len(messages) != 0 {
+		t.Errorf("reloadChanged() in a transaction = %q, want none", messages)
+	}
+	if _, err := dbManager.ExecuteQuery(context.Background(), "COMMIT"); err != nil {
+		t.Fatal(err)
+	}
+	if messages := processor.reloadChanged(); len(messages) != 1 {
+		t.Errorf("reloadChanged() after the transaction = %q, want one reload", messages)
+	}
+}
+
+func TestWatchInterval(t *testing.T) {
+	processor, _ := newTestProcessor(t)
+	stop := make(chan struct{})
+	close(stop)
+	// An interval that is not positive falls back to the default rather
+	// than panicking in time.NewTicker
+	for _, interval := range []time.Duration{0, -time.Second} {
+		processor.Watch(interval, stop, func(string) {})
+	}
+}
+
+func TestWatchSwapsMappings(t *testing.T) {
+	processor, dbManager := newTestProcessor(t)
+	filePath := writeTempFile(t, "orders.csv", "客户,金额\na,1\n")
+	if err := processor.LoadFile(filePath); err != nil {
+		t.Fatal(err)
+	}
+
+	// Queries keep translating headers while a reload replaces the mappings
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		mapper := dbManager.GetMapper()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				mapper.TranslateQuery("SELECT 客户, 金额 FROM orders;")
+				mapper.RestoreHeaders([]string{"_1", "_2"})
+			}
+		}
+	}()
+	for i := range 20 {
+		content := "客户,金额\na,1\n"
+		if i%2 == 0 {
+			content = "金额,客户\n1,a\n"
+		}
+		if err := os.WriteFile(filePath, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		processor.reloadChanged()
+	}
+	close(stop)
+	wg.Wait()
+
+	got, err := dbManager.ExecuteQuery(context.Background(), "SELECT 客户, 金额 FROM orders;")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := [][]string{{"客户", "金额"}, {"a", "1"}}; !reflect.DeepEqual(got.Table(""), want) {
+		t.Errorf("table after reloads = %v, want %v", got.Table(""), want)
+	}
+}
+
+func TestOpenForgetsSources(t *testing.T) {
+	processor, dbManager := newTestProcessor(t)
+	if err := processor.LoadFile(writeTempFile(t, "orders.csv", "id\n1\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := processor.Open(filepath.Join(t.TempDir(), "work.db")); err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	t.Cleanup(func() { dbManager.Close() })
+	if sources := processor.Sources(); len(sources) != 0 {
+		t.Errorf("Sources() after Open() = %v, want none", sources)
+	}
+	if err := processor.Reload(""); err == nil {
+		t.Error("Reload() after Open() should find no sources")
+	}
+}
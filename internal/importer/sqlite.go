@@ -0,0 +1,128 @@
+package importer
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"csvsql/internal/database"
+	"csvsql/pkg/format"
+)
+
+// sqliteMagic is the header every SQLite 3 database file starts with
+var sqliteMagic = []byte("SQLite format 3\x00")
+
+// sqliteFormat attaches existing SQLite databases as a schema named after the file
+type sqliteFormat struct{}
+
+func (sqliteFormat) Name() string            { return "sqlite" }
+func (sqliteFormat) Extensions() []string    { return []string{".db", ".sqlite", ".sqlite3"} }
+func (sqliteFormat) Detect(head []byte) bool { return bytes.HasPrefix(head, sqliteMagic) }
+
+func (sqliteFormat) Tables(filePath string, opts format.Options) ([]*Table, error) {
+	return nil, fmt.Errorf("SQLite database %s is attached, not read as tables", filePath)
+}
+
+func (sqliteFormat) Load(filePath, schema string, dbManager *database.Manager, out io.Writer) ([]string, error) {
+	ok, err := IsSQLiteFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("not a SQLite database: %s", filePath)
+	}
+
+	if schema, err = schemaName(schema, dbManager); err != nil {
+		return nil, err
+	}
+	if err := dbManager.AttachDatabase(filePath, schema); err != nil {
+		return nil, fmt.Errorf("failed to attach database %s: %v", filePath, err)
+	}
+	tables, err := dbManager.TableNames(schema)
+	if err != nil {
+		return nil, err
+	}
+	for i, table := range tables {
+		tables[i] = schema + "." + table
+	}
+
+	fmt.Fprintf(out, "Successfully attached database '%s' from %s.\n", schema, filePath)
+	return tables, nil
+}
+
+// schemaName returns the schema to attach a database as. File names without
+// ASCII letters or digits, such as Chinese ones, and names SQLite reserves
+// get a generated name: db1, db2 and so on.
+func schemaName(name string, dbManager *database.Manager) (string, error) {
+	if name != "" && !strings.EqualFold(name, "main") && !strings.EqualFold(name, "temp") {
+		return name, nil
+	}
+	attached, err := dbManager.AttachedSchemas()
+	if err != nil {
+		return "", err
+	}
+	for i := 1; ; i++ {
+		name = fmt.Sprintf("db%d", i)
+		if !slices.ContainsFunc(attached, func(s string) bool { return strings.EqualFold(s, name) }) {
+			return name, nil
+		}
+	}
+}
+
+// sqlScriptFormat executes SQL scripts and dump files against the database
+type sqlScriptFormat struct{}
+
+func (sqlScriptFormat) Name() string            { return "sql" }
+func (sqlScriptFormat) Extensions() []string    { return []string{".sql"} }
+func (sqlScriptFormat) Detect(head []byte) bool { return false }
+
+func (sqlScriptFormat) Tables(filePath string, opts format.Options) ([]*Table, error) {
+	return nil, fmt.Errorf("SQL script %s is executed, not read as tables", filePath)
+}
+
+func (sqlScriptFormat) Load(filePath, name string, dbManager *database.Manager, out io.Writer) ([]string, error) {
+	script, err := ReadSQLScript(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	before, err := dbManager.TableNames("main")
+	if err != nil {
+		return nil, err
+	}
+	if err := dbManager.ExecScript(script); err != nil {
+		return nil, fmt.Errorf("failed to execute script %s: %v", filePath, err)
+	}
+	after, err := dbManager.TableNames("main")
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Fprintf(out, "Successfully executed script %s.\n", filePath)
+	return slices.DeleteFunc(after, func(table string) bool { return slices.Contains(before, table) }), nil
+}
+
+// IsSQLiteFile reports whether the file at filePath is a SQLite 3 database
+func IsSQLiteFile(filePath string) (bool, error) {
+	head, err := format.ReadHead(filePath)
+	if err != nil {
+		return false, err
+	}
+	return bytes.HasPrefix(head, sqliteMagic), nil
+}
+
+// ReadSQLScript reads a SQL script file
+func ReadSQLScript(filePath string) (string, error) {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return "", err
+	}
+	script := string(bytes.TrimPrefix(content, []byte("\xef\xbb\xbf")))
+	if len(bytes.TrimSpace([]byte(script))) == 0 {
+		return "", fmt.Errorf("no statements found in file: %s", filePath)
+	}
+	return script, nil
+}
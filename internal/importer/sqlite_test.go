@@ -0,0 +1,182 @@
+package importer
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"csvsql/config"
+	"csvsql/internal/database"
+	"csvsql/internal/mapping"
+)
+
+func TestLoadSQLScript(t *testing.T) {
+	processor, dbManager := newTestProcessor(t)
+	filePath := writeTempFile(t, "seed.sql", "\xef\xbb\xbf-- seed data; with a semicolon\n"+
+		"CREATE TABLE items (sku TEXT, qty INTEGER);\n"+
+		"CREATE TABLE log (sku TEXT);\n"+
+		"CREATE TRIGGER tr AFTER INSERT ON items BEGIN INSERT INTO log VALUES (new.sku); END;\n"+
+		"INSERT INTO items VALUES ('a;b', 1), ('c', 2);\n")
+
+	var out strings.Builder
+	processor.out = &out
+	if err := processor.LoadFile(filePath); err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+	if !strings.Contains(out.String(), "Successfully executed script") {
+		t.Errorf("output = %q, want the script reported", out.String())
+	}
+	got, err := dbManager.ExecuteQuery(context.Background(), "SELECT group_concat(sku, '|') FROM log;")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rows := got.Table("NULL")[1][0]; rows != "a;b|c" {
+		t.Errorf("rows written by the trigger = %s, want a;b|c", rows)
+	}
+
+	if err := processor.LoadFile(writeTempFile(t, "empty.sql", "\n  \n")); err == nil {
+		t.Error("LoadFile() of an empty script should fail")
+	}
+	if err := processor.LoadFile(writeTempFile(t, "broken.sql", "INSERT INTO missing VALUES (1);")); err == nil {
+		t.Error("LoadFile() of a failing script should fail")
+	}
+}
+
+func TestLoadSQLScriptTwice(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "work.db")
+	// start opens the persistent database as a new run of csvsql would
+	start := func(policy string) (*Processor, *database.Manager) {
+		t.Helper()
+		db, err := sql.Open(database.DriverName, dbPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		db.SetMaxOpenConns(1)
+		t.Cleanup(func() { db.Close() })
+		dbManager := database.NewManager(db, mapping.NewMapper())
+		processor := NewProcessor(dbManager, &config.Config{ImportPolicy: policy})
+		processor.out = io.Discard
+		return processor, dbManager
+	}
+	rows := func(dbManager *database.Manager) string {
+		t.Helper()
+		got, err := dbManager.ExecuteQuery(context.Background(), "SELECT group_concat(sku) FROM items;")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return got.Table("NULL")[1][0]
+	}
+	script := writeTempFile(t, "seed.sql", "CREATE TABLE items (sku TEXT); INSERT INTO items VALUES ('a'), ('b');")
+
+	processor, dbManager := start(config.PolicyReplace)
+	if err := processor.LoadFile(script); err != nil {
+		t.Fatal(err)
+	}
+	if sources := processor.Sources(); len(sources) != 1 || !reflect.DeepEqual(sources[0].Tables, []string{"items"}) {
+		t.Errorf("Sources() = %+v, want the script with table items", sources)
+	}
+
+	// An unchanged script is not run again after a restart
+	processor, dbManager = start(config.PolicyFail)
+	if err := processor.LoadFile(script); err != nil {
+		t.Fatalf("second LoadFile() error = %v", err)
+	}
+	if got := rows(dbManager); got != "a,b" {
+		t.Errorf("rows after the second load = %s, want a,b", got)
+	}
+
+	// A changed script follows the import policy
+	if err := os.WriteFile(script, []byte("CREATE TABLE items (sku TEXT); INSERT INTO items VALUES ('c');"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := processor.LoadFile(script); err == nil {
+		t.Error("LoadFile() of a changed script with --fail should fail")
+	}
+	processor, dbManager = start(config.PolicyReplace)
+	if err := processor.LoadFile(script); err != nil {
+		t.Fatalf("LoadFile() with --replace error = %v", err)
+	}
+	if got := rows(dbManager); got != "c" {
+		t.Errorf("rows after replacing = %s, want c", got)
+	}
+
+	// Reloading runs the script again in place of its tables
+	if err := processor.Reload("items"); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if got := rows(dbManager); got != "c" {
+		t.Errorf("rows after reloading = %s, want c", got)
+	}
+}
+
+// writeSQLite creates a SQLite database file holding one table
+func writeSQLite(t *testing.T, name string) string {
+	t.Helper()
+	filePath := filepath.Join(t.TempDir(), name)
+	db, err := sql.Open(database.DriverName, filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec("CREATE TABLE t (n INTEGER); INSERT INTO t VALUES (1), (2);"); err != nil {
+		t.Fatal(err)
+	}
+	return filePath
+}
+
+func TestAttachDatabase(t *testing.T) {
+	processor, dbManager := newTestProcessor(t)
+
+	tests := []struct {
+		file   string
+		schema string
+	}{
+		{"sales.db", "sales"},
+		{"销售.sqlite", "db1"}, // no ASCII letters to name the schema after
+		{"main.db", "db2"},   // main is the database itself
+		{"reference.bin", "reference"},
+	}
+	for _, tt := range tests {
+		if err := processor.LoadFile(writeSQLite(t, tt.file)); err != nil {
+			t.Fatalf("LoadFile(%s) error = %v", tt.file, err)
+		}
+		got, err := dbManager.ExecuteQuery(context.Background(), "SELECT group_concat(n) FROM "+tt.schema+".t;")
+		if err != nil {
+			t.Errorf("query of %s as %s error = %v", tt.file, tt.schema, err)
+			continue
+		}
+		if rows := got.Table("NULL")[1][0]; rows != "1,2" {
+			t.Errorf("rows of %s = %s, want 1,2", tt.schema, rows)
+		}
+	}
+
+	schemas, err := dbManager.AttachedSchemas()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"sales", "db1", "db2", "reference"}; !reflect.DeepEqual(schemas, want) {
+		t.Errorf("AttachedSchemas() = %v, want %v", schemas, want)
+	}
+
+	// Attached databases are read-only
+	if _, err := dbManager.ExecuteQuery(context.Background(), "INSERT INTO sales.t VALUES (3);"); err == nil {
+		t.Error("writing to an attached database should fail")
+	}
+
+	// A database loaded again, or reloaded, is attached again
+	sales := processor.Sources()[0].Path
+	if err := processor.LoadFile(sales); err != nil {
+		t.Errorf("second LoadFile() of a database error = %v", err)
+	}
+	if err := processor.Reload("sales.t"); err != nil {
+		t.Errorf("Reload() of an attached table error = %v", err)
+	}
+	if schemas, _ := dbManager.AttachedSchemas(); len(schemas) != 4 {
+		t.Errorf("AttachedSchemas() after reloading = %v, want 4 schemas", schemas)
+	}
+}
@@ -0,0 +1,204 @@
+package importer
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"csvsql/pkg/format"
+
+	"golang.org/x/net/html/charset"
+)
+
+// xmlFormat reads XML files, turning each element on the configured row path into a row
+type xmlFormat struct{}
+
+func (xmlFormat) Name() string         { return "xml" }
+func (xmlFormat) Extensions() []string { return []string{".xml"} }
+
+func (xmlFormat) Detect(head []byte) bool {
+	return bytes.HasPrefix(trimHead(head), []byte("<?xml"))
+}
+
+func (xmlFormat) Tables(filePath string, opts format.Options) ([]*Table, error) {
+	return []*Table{openXML(filePath, opts.XMLPath)}, nil
+}
+
+// xmlFrame tracks an open element inside a row
+type xmlFrame struct {
+	column      string
+	text        strings.Builder
+	hasChildren bool
+}
+
+// xmlRow collects the column values of one row element
+type xmlRow struct {
+	columns []string // in the order first seen
+	values  map[string]string
+}
+
+// set stores a column value; repeated elements are joined with "; "
+func (r *xmlRow) set(column, value string) {
+	prev, ok := r.values[column]
+	if !ok {
+		r.columns = append(r.columns, column)
+	}
+	if ok && prev != "" {
+		if value == "" {
+			return
+		}
+		value = prev + "; " + value
+	}
+	r.values[column] = value
+}
+
+// ReadXML reads an XML file where every element matching rowPath becomes a
+// row. The path is absolute ("/Invoices/Invoice"), may start with "//" to
+// match at any depth ("//Invoice"), and may use "*" for any element name; an
+// empty path selects the children of the document root. Attributes and child
+// elements of a row become columns, with nested elements flattened into
+// names such as "Buyer_Name".
+func ReadXML(filePath, rowPath string) ([][]string, error) {
+	return collectRecords(openXML(filePath, rowPath))
+}
+
+// openXML prepares an XML file for reading, see ReadXML. Rows may have
+// different columns, so the file is read twice: once for the header and
+// once for the rows, which are yielded as they are parsed.
+func openXML(filePath, rowPath string) *Table {
+	t := &Table{Meta: Metadata{Format: "xml", Source: filePath, Detail: rowPath}}
+	t.Records = func(yield func([]string, error) bool) {
+		var headers []string
+		seen := make(map[string]bool)
+		err := scanXML(filePath, rowPath, func(row *xmlRow) bool {
+			for _, column := range row.columns {
+				if !seen[column] {
+					seen[column] = true
+					headers = append(headers, column)
+				}
+			}
+			return true
+		})
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		if len(headers) == 0 || !yield(headers, nil) {
+			return
+		}
+
+		err = scanXML(filePath, rowPath, func(row *xmlRow) bool {
+			values := make([]string, len(headers))
+			for i, h := range headers {
+				values[i] = row.values[h]
+			}
+			return yield(values, nil)
+		})
+		if err != nil {
+			yield(nil, err)
+		}
+	}
+	return t
+}
+
+// scanXML parses an XML file and calls visit with every row element matching
+// rowPath until visit returns false
+func scanXML(filePath, rowPath string, visit func(row *xmlRow) bool) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	anyDepth := strings.HasPrefix(rowPath, "//")
+	segments := strings.Split(strings.Trim(rowPath, "/"), "/")
+	if strings.Trim(rowPath, "/") == "" {
+		segments = []string{"*", "*"}
+		anyDepth = false
+	}
+
+	decoder := xml.NewDecoder(file)
+	decoder.CharsetReader = charset.NewReaderLabel
+
+	var stack []string
+	var frames []*xmlFrame
+	var row *xmlRow
+	rowDepth := 0
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("invalid XML in %s: %v", filePath, err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			stack = append(stack, t.Name.Local)
+
+			if row == nil {
+				if !matchXMLPath(stack, segments, anyDepth) {
+					continue
+				}
+				row = &xmlRow{values: make(map[string]string)}
+				rowDepth = len(stack)
+				frames = []*xmlFrame{{column: t.Name.Local}}
+				for _, attr := range t.Attr {
+					row.set(attr.Name.Local, attr.Value)
+				}
+				continue
+			}
+
+			frames[len(frames)-1].hasChildren = true
+			column := strings.Join(stack[rowDepth:], "_")
+			frames = append(frames, &xmlFrame{column: column})
+			for _, attr := range t.Attr {
+				row.set(column+"_"+attr.Name.Local, attr.Value)
+			}
+
+		case xml.CharData:
+			if row != nil {
+				frames[len(frames)-1].text.Write(t)
+			}
+
+		case xml.EndElement:
+			if row != nil {
+				frame := frames[len(frames)-1]
+				frames = frames[:len(frames)-1]
+				text := strings.TrimSpace(frame.text.String())
+
+				// Leaf elements hold values; a row element with only text is a column itself
+				if !frame.hasChildren && (len(frames) > 0 || text != "") {
+					row.set(frame.column, text)
+				}
+
+				if len(stack) == rowDepth {
+					if !visit(row) {
+						return nil
+					}
+					row = nil
+				}
+			}
+			stack = stack[:len(stack)-1]
+		}
+	}
+}
+
+// matchXMLPath reports whether the open element stack matches the row path
+func matchXMLPath(stack, segments []string, anyDepth bool) bool {
+	if len(stack) < len(segments) || (!anyDepth && len(stack) != len(segments)) {
+		return false
+	}
+	offset := len(stack) - len(segments)
+	for i, seg := range segments {
+		if seg != "*" && seg != stack[offset+i] {
+			return false
+		}
+	}
+	return true
+}
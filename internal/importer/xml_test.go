@@ -0,0 +1,133 @@
+package importer
+
+import (
+	"reflect"
+	"testing"
+
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+const invoicesXML = `<?xml version="1.0"?>
+<Invoices>
+  <Invoice id="1">
+    <Buyer><Name>张三</Name><City>北京</City></Buyer>
+    <Item>pen</Item><Item>ink</Item>
+  </Invoice>
+  <Invoice id="2">
+    <Buyer><Name>李四</Name></Buyer>
+    <Note currency="CNY">paid</Note>
+  </Invoice>
+  <Archive><Invoice id="3"><Item>cup</Item></Invoice></Archive>
+</Invoices>`
+
+func TestReadXML(t *testing.T) {
+	filePath := writeTempFile(t, "invoices.xml", invoicesXML)
+
+	tests := []struct {
+		name    string
+		rowPath string
+		want    [][]string
+	}{
+		{
+			"absolute path", "/Invoices/Invoice",
+			[][]string{
+				{"id", "Buyer_Name", "Buyer_City", "Item", "Note_currency", "Note"},
+				{"1", "张三", "北京", "pen; ink", "", ""},
+				{"2", "李四", "", "", "CNY", "paid"},
+			},
+		},
+		{
+			"any depth", "//Invoice",
+			[][]string{
+				{"id", "Buyer_Name", "Buyer_City", "Item", "Note_currency", "Note"},
+				{"1", "张三", "北京", "pen; ink", "", ""},
+				{"2", "李四", "", "", "CNY", "paid"},
+				{"3", "", "", "cup", "", ""},
+			},
+		},
+		{
+			"wildcard", "/Invoices/*/Invoice",
+			[][]string{{"id", "Item"}, {"3", "cup"}},
+		},
+		{
+			"children of the root", "",
+			[][]string{
+				{"id", "Buyer_Name", "Buyer_City", "Item", "Note_currency", "Note", "Invoice_id", "Invoice_Item"},
+				{"1", "张三", "北京", "pen; ink", "", "", "", ""},
+				{"2", "李四", "", "", "CNY", "paid", "", ""},
+				{"", "", "", "", "", "", "3", "cup"},
+			},
+		},
+		{"no match", "/Invoices/Order", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ReadXML(filePath, tt.rowPath)
+			if err != nil {
+				t.Fatalf("ReadXML() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ReadXML() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadXMLEncodingAndErrors(t *testing.T) {
+	gbk, err := simplifiedchinese.GBK.NewEncoder().String(`<?xml version="1.0" encoding="GBK"?><r><row><城市>上海</城市></row></r>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadXML(writeTempFile(t, "gbk.xml", gbk), "")
+	if err != nil {
+		t.Fatalf("ReadXML(GBK) error = %v", err)
+	}
+	if want := [][]string{{"城市"}, {"上海"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ReadXML(GBK) = %q, want %q", got, want)
+	}
+
+	// A malformed document fails before any row is yielded
+	t.Run("malformed", func(t *testing.T) {
+		table := openXML(writeTempFile(t, "broken.xml", "<r><row><a>1</a></row><row><a>2</b></row></r>"), "")
+		var rows int
+		for _, err := range table.Records {
+			if err == nil {
+				rows++
+				continue
+			}
+			if rows != 0 {
+				t.Errorf("%d records yielded before the error, want none", rows)
+			}
+			return
+		}
+		t.Errorf("Records yielded %d records without an error", rows)
+	})
+}
+
+func TestOpenXMLStreams(t *testing.T) {
+	table := openXML(writeTempFile(t, "invoices.xml", invoicesXML), "//Invoice")
+
+	// Stopping early ends the read
+	var got [][]string
+	for record, err := range table.Records {
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, record)
+		if len(got) == 2 {
+			break
+		}
+	}
+	if len(got) != 2 || got[1][0] != "1" {
+		t.Errorf("first records = %q, want the header and invoice 1", got)
+	}
+
+	// Records can be read again from the start
+	data, err := collectRecords(table)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 4 {
+		t.Errorf("second read returned %d records, want 4", len(data))
+	}
+}
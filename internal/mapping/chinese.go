@@ -4,10 +4,13 @@ import (
 	"fmt"
 	"maps"
 	"regexp"
+	"sync"
 )
 
-// Mapper handles Chinese header to column name mappings
+// Mapper handles Chinese header to column name mappings.
+// It is safe for concurrent use.
 type Mapper struct {
+	mu              sync.RWMutex
 	chineseToColumn map[string]map[string]string // table -> chineseHeader -> columnName
 }
 
@@ -20,6 +23,9 @@ func NewMapper() *Mapper {
 
 // AddMapping adds a mapping for a table
 func (m *Mapper) AddMapping(tableName, chineseHeader, columnName string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	if m.chineseToColumn[tableName] == nil {
 		m.chineseToColumn[tableName] = make(map[string]string)
 	}
@@ -28,6 +34,9 @@ func (m *Mapper) AddMapping(tableName, chineseHeader, columnName string) {
 
 // GetColumnName gets the column name for a Chinese header in a table
 func (m *Mapper) GetColumnName(tableName, chineseHeader string) (string, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
 	if tableMappings, exists := m.chineseToColumn[tableName]; exists {
 		if columnName, found := tableMappings[chineseHeader]; found {
 			return columnName, true
@@ -38,6 +47,9 @@ func (m *Mapper) GetColumnName(tableName, chineseHeader string) (string, bool) {
 
 // GetChineseHeader gets the Chinese header for a column name in a table
 func (m *Mapper) GetChineseHeader(tableName, columnName string) (string, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
 	if tableMappings, exists := m.chineseToColumn[tableName]; exists {
 		for chineseHeader, colName := range tableMappings {
 			if colName == columnName {
@@ -50,6 +62,9 @@ func (m *Mapper) GetChineseHeader(tableName, columnName string) (string, bool) {
 
 // TranslateQuery replaces Chinese field names in SQL queries with their corresponding column names
 func (m *Mapper) TranslateQuery(query string) string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
 	// For each table, check if any Chinese headers are used in the query
 	for _, tableMappings := range m.chineseToColumn {
 		for chineseHeader, columnName := range tableMappings {
@@ -74,6 +89,9 @@ func (m *Mapper) TranslateQuery(query string) string {
 
 // RestoreHeaders replaces sanitized column names with original Chinese headers
 func (m *Mapper) RestoreHeaders(columns []string) []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
 	restoredColumns := make([]string, len(columns))
 	copy(restoredColumns, columns)
 
@@ -95,6 +113,9 @@ func (m *Mapper) RestoreHeaders(columns []string) []string {
 
 // GetMappings returns all mappings for debugging
 func (m *Mapper) GetMappings() map[string]map[string]string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
 	result := make(map[string]map[string]string)
 	for tableName, tableMappings := range m.chineseToColumn {
 		result[tableName] = make(map[string]string)
@@ -105,6 +126,9 @@ func (m *Mapper) GetMappings() map[string]map[string]string {
 
 // GetTableMappings returns mappings for a specific table
 func (m *Mapper) GetTableMappings(tableName string) map[string]string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
 	if tableMappings, exists := m.chineseToColumn[tableName]; exists {
 		result := make(map[string]string)
 		maps.Copy(result, tableMappings)
@@ -112,3 +136,28 @@ func (m *Mapper) GetTableMappings(tableName string) map[string]string {
 	}
 	return nil
 }
+
+// RemoveTable drops all mappings of a table
+func (m *Mapper) RemoveTable(tableName string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.chineseToColumn, tableName)
+}
+
+// Clear drops the mappings of every table
+func (m *Mapper) Clear() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	clear(m.chineseToColumn)
+}
+
+// SetTableMappings replaces all mappings of a table
+func (m *Mapper) SetTableMappings(tableName string, mappings map[string]string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(mappings) == 0 {
+		delete(m.chineseToColumn, tableName)
+		return
+	}
+	m.chineseToColumn[tableName] = maps.Clone(mappings)
+}
@@ -1,29 +1,60 @@
 package repl
 
 import (
+	"context"
 	"fmt"
 	"strings"
+	"time"
+	"unicode"
 
 	"csvsql/internal/database"
 	"csvsql/internal/mapping"
+	"csvsql/pkg/utils"
 )
 
+// Loader loads files into tables on behalf of REPL commands
+type Loader interface {
+	// Reload re-imports tables from the files they were loaded from
+	Reload(tableName string) error
+	// Import merges a file into a table, updating rows with a matching key
+	// value when key is not empty
+	Import(filePath, tableName, key string) (database.MergeResult, error)
+	// Open switches to the workspace kept in a SQLite file, forgetting the
+	// files loaded into the previous one
+	Open(filePath string) error
+}
+
 // Commands handles REPL command processing
 type Commands struct {
 	dbManager *database.Manager
 	mapper    *mapping.Mapper
+	loader    Loader
+	timeout   time.Duration // limit for each statement, 0 for none
 }
 
 // NewCommands creates a new commands handler
-func NewCommands(dbManager *database.Manager) *Commands {
+func NewCommands(dbManager *database.Manager, loader Loader) *Commands {
 	return &Commands{
 		dbManager: dbManager,
 		mapper:    dbManager.GetMapper(),
+		loader:    loader,
 	}
 }
 
-// ProcessCommand processes a REPL command and returns results
-func (c *Commands) ProcessCommand(input string) (CommandResult, error) {
+// Timeout returns the time limit of each statement, 0 for none
+func (c *Commands) Timeout() time.Duration {
+	return c.timeout
+}
+
+// SetTimeout sets the time limit of each statement, 0 for none
+func (c *Commands) SetTimeout(timeout time.Duration) {
+	c.timeout = timeout
+}
+
+// ProcessCommand processes a REPL command and returns results. Statements
+// are interrupted when ctx is cancelled; rows returned in the result are
+// only readable while ctx is alive.
+func (c *Commands) ProcessCommand(ctx context.Context, input string) (CommandResult, error) {
 	input = strings.TrimSpace(input)
 
 	switch strings.ToLower(input) {
@@ -32,13 +63,59 @@ func (c *Commands) ProcessCommand(input string) (CommandResult, error) {
 	case ".help":
 		return CommandResult{Type: HelpCommand, Data: getHelpText()}, nil
 	case ".tables":
-		return c.handleTablesCommand()
+		return c.handleTablesCommand(ctx)
 	case ".mappings":
 		return c.handleMappingsCommand()
+	case ".reload":
+		return c.handleReloadCommand("")
+	case ".timeout":
+		return c.handleTimeoutCommand("")
+	case ".function":
+		return c.handleFunctionCommand(ctx, "")
+	case ".macro":
+		return c.handleMacroCommand(ctx, "")
+	case ".fts":
+		return c.handleFTSCommand(ctx, "")
+	}
+
+	if strings.HasPrefix(strings.ToLower(input), ".timeout ") {
+		return c.handleTimeoutCommand(strings.TrimSpace(input[len(".timeout "):]))
+	}
+
+	if strings.HasPrefix(strings.ToLower(input), ".reload ") {
+		return c.handleReloadCommand(strings.TrimSpace(input[len(".reload "):]))
+	}
+
+	if strings.HasPrefix(strings.ToLower(input), ".import ") {
+		return c.handleImportCommand(input)
+	}
+
+	if strings.HasPrefix(strings.ToLower(input), ".save ") {
+		return c.handleSaveCommand(ctx, strings.TrimSpace(input[len(".save "):]))
+	}
+
+	if strings.HasPrefix(strings.ToLower(input), ".open ") {
+		return c.handleOpenCommand(strings.TrimSpace(input[len(".open "):]))
+	}
+
+	if strings.HasPrefix(strings.ToLower(input), ".attach ") {
+		return c.handleAttachCommand(input)
+	}
+
+	if strings.HasPrefix(strings.ToLower(input), ".function ") {
+		return c.handleFunctionCommand(ctx, strings.TrimSpace(input[len(".function "):]))
+	}
+
+	if strings.HasPrefix(strings.ToLower(input), ".macro ") {
+		return c.handleMacroCommand(ctx, strings.TrimSpace(input[len(".macro "):]))
+	}
+
+	if strings.HasPrefix(strings.ToLower(input), ".fts ") {
+		return c.handleFTSCommand(ctx, strings.TrimSpace(input[len(".fts "):]))
 	}
 
 	if strings.HasPrefix(strings.ToLower(input), ".schema ") {
-		return c.handleSchemaCommand(input)
+		return c.handleSchemaCommand(ctx, input)
 	}
 
 	if strings.HasPrefix(strings.ToUpper(input), "EXPORT ") {
@@ -46,7 +123,7 @@ func (c *Commands) ProcessCommand(input string) (CommandResult, error) {
 	}
 
 	// Default: treat as SQL query
-	return c.handleSQLQuery(input)
+	return c.handleSQLQuery(ctx, input)
 }
 
 // CommandType represents the type of command
@@ -59,6 +136,12 @@ const (
 	SchemaCommand
 	MappingsCommand
 	ExportCommand
+	ReloadCommand
+	ImportCommand
+	TimeoutCommand
+	WorkspaceCommand
+	DefinitionCommand
+	SearchIndexCommand
 	ExitCommand
 )
 
@@ -69,18 +152,31 @@ type CommandResult struct {
 	Error error
 }
 
-func (c *Commands) handleTablesCommand() (CommandResult, error) {
-	results, err := c.dbManager.ExecuteQuery("SELECT name FROM sqlite_master WHERE type='table';")
+func (c *Commands) handleTablesCommand(ctx context.Context) (CommandResult, error) {
+	schemas, err := c.dbManager.AttachedSchemas()
+	if err != nil {
+		return CommandResult{}, err
+	}
+
+	// Tables of attached databases are listed as schema.table; the import
+	// catalog kept in persistent databases is hidden
+	queries := []string{fmt.Sprintf("SELECT name FROM sqlite_master WHERE type='table' AND substr(name, 1, %d) != '%s'",
+		len(database.CatalogPrefix), database.CatalogPrefix)}
+	for _, schema := range schemas {
+		queries = append(queries, fmt.Sprintf("SELECT '%s.' || name FROM %s.sqlite_master WHERE type='table' AND substr(name, 1, %d) != '%s'",
+			schema, schema, len(database.CatalogPrefix), database.CatalogPrefix))
+	}
+	results, err := c.dbManager.ExecuteQuery(ctx, strings.Join(queries, " UNION ALL ")+";")
 	if err != nil {
 		return CommandResult{}, err
 	}
 	return CommandResult{Type: TablesCommand, Data: results}, nil
 }
 
-func (c *Commands) handleSchemaCommand(input string) (CommandResult, error) {
+func (c *Commands) handleSchemaCommand(ctx context.Context, input string) (CommandResult, error) {
 	tableName := strings.TrimSpace(strings.TrimPrefix(input, ".schema "))
 	query := fmt.Sprintf("PRAGMA table_info(%s);", tableName)
-	results, err := c.dbManager.ExecuteQuery(query)
+	results, err := c.dbManager.ExecuteQuery(ctx, query)
 	if err != nil {
 		return CommandResult{}, err
 	}
@@ -100,12 +196,256 @@ func (c *Commands) handleExportCommand(input string) (CommandResult, error) {
 	return CommandResult{Type: ExportCommand, Data: parts[1]}, nil
 }
 
-func (c *Commands) handleSQLQuery(query string) (CommandResult, error) {
-	results, err := c.dbManager.ExecuteQuery(query)
+func (c *Commands) handleReloadCommand(tableName string) (CommandResult, error) {
+	if err := c.loader.Reload(tableName); err != nil {
+		return CommandResult{}, err
+	}
+	return CommandResult{Type: ReloadCommand}, nil
+}
+
+// handleTimeoutCommand shows or sets the statement time limit, e.g. ".timeout 30s";
+// "0" or "off" removes it
+func (c *Commands) handleTimeoutCommand(value string) (CommandResult, error) {
+	switch strings.ToLower(value) {
+	case "":
+	case "0", "off":
+		c.timeout = 0
+	default:
+		timeout, err := time.ParseDuration(value)
+		if err != nil || timeout < 0 {
+			return CommandResult{}, fmt.Errorf("invalid timeout %q, expected a duration such as 30s or 2m, or off", value)
+		}
+		c.timeout = timeout
+	}
+
+	if c.timeout == 0 {
+		return CommandResult{Type: TimeoutCommand, Data: "Statements run without a time limit."}, nil
+	}
+	return CommandResult{Type: TimeoutCommand, Data: fmt.Sprintf("Statements are interrupted after %s.", c.timeout)}, nil
+}
+
+// handleImportCommand handles .import <file> INTO <table> [APPEND | UPSERT ON <key>]
+func (c *Commands) handleImportCommand(input string) (CommandResult, error) {
+	parts := splitArguments(input)
+	usage := fmt.Errorf("invalid .import command. Usage: .import <file> INTO <table> [APPEND | UPSERT ON <key>]")
+	if len(parts) < 4 || !strings.EqualFold(parts[2], "INTO") {
+		return CommandResult{}, usage
+	}
+	filePath, tableName, key := unquote(parts[1]), parts[3], ""
+
+	switch mode := parts[4:]; {
+	case len(mode) == 0, len(mode) == 1 && strings.EqualFold(mode[0], "APPEND"):
+	case len(mode) == 3 && strings.EqualFold(mode[0], "UPSERT") && strings.EqualFold(mode[1], "ON"):
+		key = mode[2]
+	default:
+		return CommandResult{}, usage
+	}
+
+	result, err := c.loader.Import(filePath, tableName, key)
+	if err != nil {
+		return CommandResult{}, err
+	}
+
+	message := fmt.Sprintf("Imported %s into table '%s': %d rows inserted, %d rows updated.", filePath, tableName, result.Inserted, result.Updated)
+	if len(result.AddedColumns) > 0 {
+		message += fmt.Sprintf("\nAdded columns: %s.", strings.Join(result.AddedColumns, ", "))
+	}
+	return CommandResult{Type: ImportCommand, Data: message}, nil
+}
+
+// handleSaveCommand copies the workspace to a SQLite file, e.g. ".save sales.db"
+func (c *Commands) handleSaveCommand(ctx context.Context, filePath string) (CommandResult, error) {
+	filePath = unquote(filePath)
+	if err := c.dbManager.Save(ctx, filePath); err != nil {
+		return CommandResult{}, fmt.Errorf("save to %s failed: %w", filePath, err)
+	}
+	return CommandResult{Type: WorkspaceCommand, Data: fmt.Sprintf("Saved the workspace to %s.", filePath)}, nil
+}
+
+// handleOpenCommand switches to the workspace kept in a SQLite file
+func (c *Commands) handleOpenCommand(filePath string) (CommandResult, error) {
+	filePath = unquote(filePath)
+	if err := c.loader.Open(filePath); err != nil {
+		return CommandResult{}, fmt.Errorf("open %s failed: %w", filePath, err)
+	}
+	tables, err := c.dbManager.Tables()
+	if err != nil {
+		return CommandResult{}, err
+	}
+	return CommandResult{Type: WorkspaceCommand, Data: fmt.Sprintf("Opened %s with %d tables.", filePath, tables)}, nil
+}
+
+// handleAttachCommand attaches a SQLite file read-only, e.g.
+// ".attach 2023.db AS last_year"; its tables are queried as last_year.table
+func (c *Commands) handleAttachCommand(input string) (CommandResult, error) {
+	parts := splitArguments(input)
+	if len(parts) != 4 || !strings.EqualFold(parts[2], "AS") {
+		return CommandResult{}, fmt.Errorf("invalid .attach command. Usage: .attach <file.db> AS <name>")
+	}
+	filePath, schema := unquote(parts[1]), parts[3]
+	if schema == "" || utils.SanitizeTableName(schema) != schema || strings.EqualFold(schema, "main") || strings.EqualFold(schema, "temp") {
+		return CommandResult{}, fmt.Errorf("invalid schema name %q, use letters, digits and underscores", schema)
+	}
+
+	if err := c.dbManager.AttachDatabase(filePath, schema); err != nil {
+		return CommandResult{}, err
+	}
+	return CommandResult{Type: WorkspaceCommand, Data: fmt.Sprintf("Attached %s as '%s'.", filePath, schema)}, nil
+}
+
+// splitArguments splits a command at spaces outside quotes, so that a file
+// name such as "my data.csv" stays one argument; the quotes are kept for
+// unquote to remove
+func splitArguments(input string) []string {
+	var parts []string
+	var quote rune
+	start := -1
+	for i, r := range input {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case unicode.IsSpace(r):
+			if start >= 0 {
+				parts = append(parts, input[start:i])
+				start = -1
+			}
+		default:
+			if start < 0 {
+				start = i
+			}
+			if r == '"' || r == '\'' {
+				quote = r
+			}
+		}
+	}
+	if start >= 0 {
+		parts = append(parts, input[start:])
+	}
+	return parts
+}
+
+// unquote removes the quotes around a file name such as "my data.db"
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// handleFunctionCommand lists the user functions, defines one, e.g.
+// ".function fiscal_q(d) AS (CAST(strftime('%m', d) AS INTEGER) + 2) / 3",
+// or drops one with ".function drop <name>"
+func (c *Commands) handleFunctionCommand(ctx context.Context, input string) (CommandResult, error) {
+	if input == "" {
+		return listDefinitions("functions", ".function", c.dbManager.Functions()), nil
+	}
+	if name, ok := dropName(input); ok {
+		if err := c.dbManager.DropFunction(ctx, name); err != nil {
+			return CommandResult{}, err
+		}
+		return CommandResult{Type: DefinitionCommand, Data: fmt.Sprintf("Dropped function %s.", name)}, nil
+	}
+
+	def, err := database.ParseDefinition(input)
+	if err != nil {
+		return CommandResult{}, fmt.Errorf("%w. Usage: .function name(param, ...) AS <expression>", err)
+	}
+	if err := c.dbManager.DefineFunction(ctx, def); err != nil {
+		return CommandResult{}, err
+	}
+	return CommandResult{Type: DefinitionCommand, Data: fmt.Sprintf("Defined function %s(%s).", def.Name, strings.Join(def.Params, ", "))}, nil
+}
+
+// handleMacroCommand lists the macros, defines one, e.g.
+// ".macro top(n, col) AS SELECT * FROM sales ORDER BY {col} DESC LIMIT {n}",
+// or drops one with ".macro drop <name>"
+func (c *Commands) handleMacroCommand(ctx context.Context, input string) (CommandResult, error) {
+	if input == "" {
+		return listDefinitions("macros", ".macro", c.dbManager.Macros()), nil
+	}
+	if name, ok := dropName(input); ok {
+		if err := c.dbManager.DropMacro(ctx, name); err != nil {
+			return CommandResult{}, err
+		}
+		return CommandResult{Type: DefinitionCommand, Data: fmt.Sprintf("Dropped macro %s.", name)}, nil
+	}
+
+	def, err := database.ParseDefinition(input)
+	if err != nil {
+		return CommandResult{}, fmt.Errorf("%w. Usage: .macro name(param, ...) AS <SQL text using {param}>", err)
+	}
+	if err := c.dbManager.DefineMacro(ctx, def); err != nil {
+		return CommandResult{}, err
+	}
+	return CommandResult{Type: DefinitionCommand, Data: fmt.Sprintf("Defined macro @%s(%s).", def.Name, strings.Join(def.Params, ", "))}, nil
+}
+
+// dropName returns the name in "drop <name>"
+func dropName(input string) (string, bool) {
+	parts := strings.Fields(input)
+	if len(parts) == 2 && strings.EqualFold(parts[0], "drop") {
+		return parts[1], true
+	}
+	return "", false
+}
+
+// listDefinitions shows definitions as they would be entered
+func listDefinitions(kind, command string, defs []database.Definition) CommandResult {
+	if len(defs) == 0 {
+		return CommandResult{Type: DefinitionCommand, Data: fmt.Sprintf("No %s defined.", kind)}
+	}
+	lines := make([]string, len(defs))
+	for i, def := range defs {
+		lines[i] = command + " " + def.String()
+	}
+	return CommandResult{Type: DefinitionCommand, Data: strings.Join(lines, "\n")}
+}
+
+// handleFTSCommand lists the full-text indexes, builds the index of a table
+// over some or all of its columns, e.g. ".fts orders 备注, 描述", or drops
+// one with ".fts drop <table>"
+func (c *Commands) handleFTSCommand(ctx context.Context, input string) (CommandResult, error) {
+	if input == "" {
+		indexes, err := c.dbManager.SearchIndexes()
+		if err != nil {
+			return CommandResult{}, err
+		}
+		if len(indexes) == 0 {
+			return CommandResult{Type: SearchIndexCommand, Data: "No full-text indexes. Create one with .fts <table> [columns]."}, nil
+		}
+		lines := make([]string, len(indexes))
+		for i, index := range indexes {
+			lines[i] = fmt.Sprintf("%s: %s", index.Table, strings.Join(c.mapper.RestoreHeaders(index.Columns), ", "))
+		}
+		return CommandResult{Type: SearchIndexCommand, Data: strings.Join(lines, "\n")}, nil
+	}
+	if tableName, ok := dropName(input); ok {
+		if err := c.dbManager.DropSearchIndex(ctx, tableName); err != nil {
+			return CommandResult{}, err
+		}
+		return CommandResult{Type: SearchIndexCommand, Data: fmt.Sprintf("Dropped the full-text index of %s.", tableName)}, nil
+	}
+
+	fields := strings.FieldsFunc(input, func(r rune) bool { return r == ' ' || r == '\t' || r == ',' })
+	tableName, columns := fields[0], fields[1:]
+	n, err := c.dbManager.CreateSearchIndex(ctx, tableName, columns)
+	if err != nil {
+		return CommandResult{}, err
+	}
+	return CommandResult{Type: SearchIndexCommand, Data: fmt.Sprintf("Indexed %d rows of %s. Query with SELECT * FROM search(%s, '...').", n, tableName, tableName)}, nil
+}
+
+// handleSQLQuery runs the statements of the input, with macros and searches
+// expanded, as they are read from the iterator. Rows are streamed to the
+// caller, who must read or close them before moving on.
+func (c *Commands) handleSQLQuery(ctx context.Context, query string) (CommandResult, error) {
+	query, err := c.dbManager.ExpandMacros(query)
 	if err != nil {
 		return CommandResult{}, err
 	}
-	return CommandResult{Type: SQLQueryCommand, Data: results}, nil
+	return CommandResult{Type: SQLQueryCommand, Data: c.dbManager.Run(ctx, query)}, nil
 }
 
 func getHelpText() string {
@@ -114,7 +454,26 @@ func getHelpText() string {
   .tables            List available tables.
   .schema <table>    Show the schema for a table.
   .mappings          Show Chinese header to column name mappings.
+  .reload [table]    Re-import a table (or all tables) from its source file.
+  .import <file> INTO <table> [APPEND | UPSERT ON <key>]
+                     Add the rows of a file to a table, adding new columns;
+                     with UPSERT rows matching on <key> are updated.
+  .save <file.db>    Save the workspace, with its header mappings, to a SQLite file.
+  .open <file.db>    Switch to the workspace in a SQLite file, creating it if needed.
+  .attach <file.db> AS <name>
+                     Attach a SQLite file read-only; query its tables as name.table.
+  .timeout [duration|off]
+                     Show or set the time limit of each statement, e.g. 30s.
+  .function [name(param, ...) AS <expression> | drop <name>]
+                     List, define or drop SQL functions, e.g.
+                     .function fiscal_q(d) AS (CAST(strftime('%m', d) AS INTEGER) + 2) / 3
+  .macro [name(param, ...) AS <SQL text> | drop <name>]
+                     List, define or drop macros; @name(arg, ...) in SQL is replaced
+                     by the text with each {param} replaced by its argument.
+  .fts [<table> [columns] | drop <table>]
+                     List, build or drop full-text indexes; search an indexed table
+                     with SELECT * FROM search(<table>, 'words').
   .exit, .quit       Exit the application.
-  EXPORT <file.csv>  Export the last SELECT query results to a CSV file.
-  Any other text is treated as an SQL query.`
+  EXPORT <file.csv>  Export the rows of the last query shown to a CSV file.
+  Any other text is treated as an SQL query; Ctrl-C interrupts a running query.`
 }
@@ -0,0 +1,24 @@
+package repl
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitArguments(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []string
+	}{
+		{".import delta.csv INTO orders", []string{".import", "delta.csv", "INTO", "orders"}},
+		{`.import "my data.csv"  INTO orders UPSERT ON 订单号`, []string{".import", `"my data.csv"`, "INTO", "orders", "UPSERT", "ON", "订单号"}},
+		{".attach '2023 订单.db' AS last_year", []string{".attach", "'2023 订单.db'", "AS", "last_year"}},
+		{`.import "open quote.csv INTO t`, []string{".import", `"open quote.csv INTO t`}},
+		{"  ", nil},
+	}
+	for _, tt := range tests {
+		if got := splitArguments(tt.input); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitArguments(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
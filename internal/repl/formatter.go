@@ -2,81 +2,288 @@ package repl
 
 import (
 	"encoding/csv"
+	"errors"
 	"fmt"
+	"io"
+	"iter"
 	"os"
 	"strings"
-	"text/tabwriter"
+	"time"
+
+	"csvsql/internal/database"
+	"csvsql/pkg/utils"
 )
 
+// streamChunk is the number of rows whose column widths are measured
+// together when results are printed without a pager
+const streamChunk = 100
+
+// errNothingToExport is returned by ExportToCSV before any query has shown rows
+var errNothingToExport = errors.New("no results to export, run a SELECT query first")
+
 // Formatter handles output formatting for the REPL
-type Formatter struct{}
+type Formatter struct {
+	nullDisplay string      // how SQL NULL is shown in the terminal
+	nullExport  string      // how SQL NULL is written to exported files
+	pageSize    int         // rows per page, 0 to print without pausing
+	more        func() bool // asks whether to show the next page
+	out         io.Writer
+	shown       *spool // the rows of the last query shown, for EXPORT
+}
 
-// NewFormatter creates a new formatter
-func NewFormatter() *Formatter {
-	return &Formatter{}
+// NewFormatter creates a new formatter rendering SQL NULL as nullDisplay in
+// the terminal and as nullExport in exported files
+func NewFormatter(nullDisplay, nullExport string) *Formatter {
+	return &Formatter{nullDisplay: nullDisplay, nullExport: nullExport, out: os.Stdout}
 }
 
-// PrintResults formats and prints data to the console
-func (f *Formatter) PrintResults(data [][]string) {
-	if len(data) <= 1 {
-		fmt.Println("Query OK, 0 rows returned.")
-		return
+// SetPageSize makes the formatter pause after every pageSize rows of a
+// query and ask whether to continue. A pageSize of 0 turns the pager off.
+func (f *Formatter) SetPageSize(pageSize int) {
+	f.pageSize = pageSize
+}
+
+// PrintResults formats and prints query results to the console, such as
+// those of .tables and .schema. The rows shown are kept for ExportToCSV.
+func (f *Formatter) PrintResults(result *database.Result) {
+	shown := f.keepShown(result.Names())
+	exported := result.Table(f.nullExport)
+	rows := func(yield func([]string, error) bool) {
+		for i, row := range result.Table(f.nullDisplay)[1:] {
+			if !yield(row, nil) {
+				return
+			}
+			if shown != nil {
+				shown.write(exported[i+1])
+			}
+		}
 	}
+	f.printTable(result.Names(), rows)
+}
+
+// PrintRows prints streamed query results as they arrive, a page at a time
+// when the pager is on, and closes them. The rows shown are kept for
+// ExportToCSV.
+func (f *Formatter) PrintRows(rows *database.Rows) error {
+	defer rows.Close()
+
+	shown := f.keepShown(rows.Names())
 
-	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-	// Write headers
-	fmt.Fprintln(writer, strings.Join(data[0], "\t"))
-	// Write separator
-	headerSeparators := make([]string, len(data[0]))
-	for i, h := range data[0] {
-		headerSeparators[i] = strings.Repeat("-", len(h))
+	cells := func(yield func([]string, error) bool) {
+		for row, err := range rows.All() {
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			text := make([]string, len(row))
+			for i, v := range row {
+				text[i] = database.FormatValue(v, f.nullDisplay)
+			}
+			if !yield(text, nil) {
+				return
+			}
+			// Only rows printed are kept; the pager may stop before one
+			if shown != nil {
+				record := make([]string, len(row))
+				for i, v := range row {
+					record[i] = database.FormatValue(v, f.nullExport)
+				}
+				shown.write(record)
+			}
+		}
 	}
-	fmt.Fprintln(writer, strings.Join(headerSeparators, "\t"))
+	return f.printTable(rows.Names(), cells)
+}
 
-	// Write rows
-	for _, row := range data[1:] {
-		fmt.Fprintln(writer, strings.Join(row, "\t"))
+// keepShown replaces the rows kept for ExportToCSV with a new spool under
+// header, or with nothing if the spool cannot be created
+func (f *Formatter) keepShown(header []string) *spool {
+	shown, err := newSpool(header)
+	if err != nil {
+		fmt.Fprintln(f.out, "Warning: the results cannot be exported:", err)
 	}
-	writer.Flush()
-	fmt.Printf("\n(%d rows)\n", len(data)-1)
+	f.Close()
+	f.shown = shown
+	return shown
+}
+
+// printTable prints rows under a header as they arrive. Column widths are
+// measured on the first page (or chunk) and grow when later rows are wider.
+func (f *Formatter) printTable(header []string, rows iter.Seq2[[]string, error]) error {
+	widths := make([]int, len(header))
+	for i, h := range header {
+		widths[i] = utils.StringWidth(h)
+	}
+	chunk := streamChunk
+	if f.pageSize > 0 {
+		chunk = f.pageSize
+	}
+
+	var page [][]string
+	count, printed := 0, false
+	flush := func() {
+		for _, row := range page {
+			for i, cell := range row {
+				if i < len(widths) {
+					widths[i] = max(widths[i], utils.StringWidth(cell))
+				}
+			}
+		}
+		if !printed {
+			separators := make([]string, len(header))
+			for i, h := range header {
+				separators[i] = strings.Repeat("-", utils.StringWidth(h))
+			}
+			f.printRow(header, widths)
+			f.printRow(separators, widths)
+			printed = true
+		}
+		for _, row := range page {
+			f.printRow(row, widths)
+		}
+		page = page[:0]
+	}
+
+	for row, err := range rows {
+		if err != nil {
+			if count > 0 {
+				flush()
+			}
+			return err
+		}
+		if len(page) == 0 && count > 0 && count%chunk == 0 && f.pageSize > 0 && f.more != nil && !f.more() {
+			fmt.Fprintf(f.out, "\n(%d rows shown)\n", count)
+			return nil
+		}
+		page = append(page, row)
+		count++
+		if len(page) == chunk {
+			flush()
+		}
+	}
+
+	if count == 0 {
+		fmt.Fprintln(f.out, "Query OK, 0 rows returned.")
+		return nil
+	}
+	flush()
+	fmt.Fprintf(f.out, "\n(%d rows)\n", count)
+	return nil
+}
+
+// printRow prints cells padded to the column widths, two spaces apart
+func (f *Formatter) printRow(cells []string, widths []int) {
+	var b strings.Builder
+	for i, cell := range cells {
+		b.WriteString(cell)
+		if i < len(cells)-1 && i < len(widths) {
+			b.WriteString(strings.Repeat(" ", widths[i]-utils.StringWidth(cell)+2))
+		}
+	}
+	fmt.Fprintln(f.out, b.String())
+}
+
+// PrintAffected reports the outcome of a statement that returned no rows
+func (f *Formatter) PrintAffected(result *database.Result) {
+	fmt.Fprintf(f.out, "Query OK, %d rows affected (%s)\n", result.RowsAffected, result.Elapsed.Round(time.Microsecond))
 }
 
 // PrintMappings displays the current Chinese header mappings for all tables
 func (f *Formatter) PrintMappings(mappings map[string]map[string]string) {
 	if len(mappings) == 0 {
-		fmt.Println("No Chinese header mappings found.")
+		fmt.Fprintln(f.out, "No Chinese header mappings found.")
 		return
 	}
 
-	fmt.Print("Chinese Header Mappings:\n")
-	fmt.Print("========================\n")
+	fmt.Fprint(f.out, "Chinese Header Mappings:\n")
+	fmt.Fprint(f.out, "========================\n")
 
 	for tableName, tableMappings := range mappings {
 		if len(tableMappings) > 0 {
-			fmt.Printf("Table: %s\n", tableName)
-			fmt.Print("-------------------\n")
+			fmt.Fprintf(f.out, "Table: %s\n", tableName)
+			fmt.Fprint(f.out, "-------------------\n")
 			for chineseHeader, columnName := range tableMappings {
-				fmt.Printf("  %s -> %s\n", chineseHeader, columnName)
+				fmt.Fprintf(f.out, "  %s -> %s\n", chineseHeader, columnName)
 			}
 		}
 	}
 }
 
-// ExportToCSV saves query results to a CSV file
-func (f *Formatter) ExportToCSV(filename string, data [][]string) error {
-	if len(data) <= 1 {
-		return fmt.Errorf("no results to export. run a SELECT query first")
+// ExportToCSV writes the rows of the last query shown to a CSV file,
+// without running the query again, so the file holds what was seen
+func (f *Formatter) ExportToCSV(filename string) error {
+	if f.shown == nil {
+		return errNothingToExport
+	}
+	if err := f.shown.copyTo(filename); err != nil {
+		return err
+	}
+	fmt.Fprintf(f.out, "Exported %d rows to %s.\n", f.shown.count, filename)
+	return nil
+}
+
+// Close removes the rows kept for ExportToCSV
+func (f *Formatter) Close() error {
+	if f.shown == nil {
+		return nil
 	}
+	err := f.shown.remove()
+	f.shown = nil
+	return err
+}
 
-	file, err := os.Create(filename)
+// spool keeps rows in a temporary CSV file, so that large results can be
+// exported after they were shown without holding them in memory
+type spool struct {
+	file   *os.File
+	writer *csv.Writer
+	count  int
+}
+
+// newSpool creates a spool starting with the header
+func newSpool(header []string) (*spool, error) {
+	file, err := os.CreateTemp("", "csvsql-result-*.csv")
 	if err != nil {
+		return nil, err
+	}
+	s := &spool{file: file, writer: csv.NewWriter(file)}
+	if err := s.writer.Write(header); err != nil {
+		s.remove()
+		return nil, err
+	}
+	return s, nil
+}
+
+// write adds a row; write errors are reported by copyTo
+func (s *spool) write(record []string) {
+	if s.writer.Write(record) == nil {
+		s.count++
+	}
+}
+
+// copyTo writes the rows kept so far to a new file
+func (s *spool) copyTo(filename string) error {
+	s.writer.Flush()
+	if err := s.writer.Error(); err != nil {
+		return err
+	}
+	if _, err := s.file.Seek(0, io.SeekStart); err != nil {
 		return err
 	}
-	defer file.Close()
 
-	writer := csv.NewWriter(file)
-	defer writer.Flush()
+	dest, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dest, s.file)
+	if closeErr := dest.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
 
-	fmt.Printf("Exporting %d rows to %s...\n", len(data)-1, filename)
-	return writer.WriteAll(data)
+// remove deletes the temporary file
+func (s *spool) remove() error {
+	s.file.Close()
+	return os.Remove(s.file.Name())
 }
@@ -0,0 +1,134 @@
+package repl
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"csvsql/internal/database"
+	"csvsql/internal/mapping"
+)
+
+// newTestFormatter creates a formatter writing to a buffer and a manager
+// for an in-memory database to query
+func newTestFormatter(t *testing.T) (*Formatter, *bytes.Buffer, *database.Manager) {
+	t.Helper()
+	db, err := sql.Open(database.DriverName, ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	var out bytes.Buffer
+	f := NewFormatter("NULL", "")
+	f.out = &out
+	t.Cleanup(func() { f.Close() })
+	return f, &out, database.NewManager(db, mapping.NewMapper())
+}
+
+const fiveRows = "SELECT column1 AS 名称, column2 AS n FROM (VALUES ('a', 1), ('bb', NULL), ('c', 3), ('d', 4), ('e', 5));"
+
+func TestPrintRows(t *testing.T) {
+	f, out, m := newTestFormatter(t)
+	rows, err := m.QueryRows(context.Background(), fiveRows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.PrintRows(rows); err != nil {
+		t.Fatal(err)
+	}
+
+	// Columns are as wide as their widest cell, Chinese characters counting twice
+	want := strings.Join([]string{
+		"名称  n",
+		"----  -",
+		"a     1",
+		"bb    NULL",
+		"c     3",
+		"d     4",
+		"e     5",
+		"",
+		"(5 rows)",
+		"",
+	}, "\n")
+	if out.String() != want {
+		t.Errorf("PrintRows() printed\n%s\nwant\n%s", out.String(), want)
+	}
+}
+
+func TestPagerAndExport(t *testing.T) {
+	f, out, m := newTestFormatter(t)
+	exported := filepath.Join(t.TempDir(), "out.csv")
+	if err := f.ExportToCSV(exported); !errors.Is(err, errNothingToExport) {
+		t.Errorf("ExportToCSV() before a query error = %v, want %v", err, errNothingToExport)
+	}
+
+	// The reader stops after the second page
+	f.SetPageSize(2)
+	pages := 0
+	f.more = func() bool {
+		pages++
+		return pages < 2
+	}
+	rows, err := m.QueryRows(context.Background(), fiveRows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.PrintRows(rows); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(out.String(), "\n(4 rows shown)\n") {
+		t.Errorf("PrintRows() with a pager printed\n%s\nwant 4 rows shown", out.String())
+	}
+
+	// Only the rows shown are exported, NULL as an empty cell
+	if err := f.ExportToCSV(exported); err != nil {
+		t.Fatalf("ExportToCSV() error = %v", err)
+	}
+	got, err := os.ReadFile(exported)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "名称,n\na,1\nbb,\nc,3\nd,4\n"; string(got) != want {
+		t.Errorf("exported file = %q, want %q", got, want)
+	}
+	if !strings.HasSuffix(out.String(), "Exported 4 rows to "+exported+".\n") {
+		t.Errorf("ExportToCSV() printed %q", out.String())
+	}
+}
+
+func TestExportCommandResults(t *testing.T) {
+	f, _, m := newTestFormatter(t)
+	if err := m.CreateAndInsert("orders", [][]string{{"客户"}, {"a"}}); err != nil {
+		t.Fatal(err)
+	}
+	commands := NewCommands(m, nil)
+	result, err := commands.ProcessCommand(context.Background(), ".tables")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, ok := result.Data.(*database.Result)
+	if !ok {
+		t.Fatalf(".tables returned %T, want *database.Result", result.Data)
+	}
+
+	// The output of .tables can be exported like that of a query
+	f.PrintResults(data)
+	exported := filepath.Join(t.TempDir(), "tables.csv")
+	if err := f.ExportToCSV(exported); err != nil {
+		t.Fatalf("ExportToCSV() after .tables error = %v", err)
+	}
+	got, err := os.ReadFile(exported)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(got), "orders") {
+		t.Errorf("exported file = %q, want the table orders", got)
+	}
+}
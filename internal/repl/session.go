@@ -2,16 +2,77 @@ package repl
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"fmt"
+	"iter"
 	"os"
+	"os/signal"
 	"strings"
+	"sync"
+	"time"
+
+	"csvsql/internal/database"
+)
+
+// Prompts printed whenever the REPL waits for input
+const (
+	prompt             = "sql> "
+	transactionPrompt  = "sql*> " // inside a transaction begun with BEGIN
+	continuationPrompt = "...> "  // inside a statement spanning lines
 )
 
+// errInterrupted is the cause of statements cancelled with Ctrl-C
+var errInterrupted = errors.New("query interrupted")
+
 // Session manages the REPL session
 type Session struct {
-	commands    *Commands
-	formatter   *Formatter
-	lastResults [][]string
+	commands  *Commands
+	formatter *Formatter
+
+	mu      sync.Mutex
+	cancel  context.CancelCauseFunc // cancels the running command, nil at the prompt
+	timer   *time.Timer             // timeout of the running command, nil without one
+	left    time.Duration           // time the running command had left when its timer last started
+	resumed time.Time               // when the timer last started
+	prompt  string                  // prompt printed last
+	held    []string                // messages that arrived while a command ran
+}
+
+// Notify prints a message that arrives while the REPL waits for input,
+// such as a table reloaded in watch mode, and repeats the prompt. Messages
+// arriving while a command runs are held back until it is done, so they do
+// not break into its output.
+func (s *Session) Notify(message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cancel != nil {
+		s.held = append(s.held, message)
+		return
+	}
+	fmt.Printf("\n%s\n%s", message, s.prompt)
+}
+
+// printPrompt prints the messages held back and the prompt, and remembers
+// the prompt for Notify
+func (s *Session) printPrompt(p string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, message := range s.held {
+		fmt.Println(message)
+	}
+	s.held = nil
+	s.prompt = p
+	fmt.Print(p)
+}
+
+// nextPrompt returns the prompt for the next command, marking an open
+// transaction
+func (s *Session) nextPrompt() string {
+	if s.commands.dbManager.InTransaction() {
+		return transactionPrompt
+	}
+	return prompt
 }
 
 // NewSession creates a new REPL session
@@ -24,56 +85,163 @@ func NewSession(commands *Commands, formatter *Formatter) *Session {
 
 // Run starts the interactive REPL session
 func (s *Session) Run() {
+	defer s.formatter.Close()
 	fmt.Println("\nEnter SQL commands or type .help for help.")
 	scanner := bufio.NewScanner(os.Stdin)
-	fmt.Print("sql> ")
+	s.formatter.more = func() bool {
+		// Time spent reading a page does not count towards the timeout;
+		// the command goes on with the time it had left
+		if s.timer != nil && s.timer.Stop() {
+			s.left -= time.Since(s.resumed)
+			defer func() {
+				s.resumed = time.Now()
+				s.timer.Reset(s.left)
+			}()
+		}
+		fmt.Print("-- more: Enter for the next page, q to stop -- ")
+		return scanner.Scan() && !strings.EqualFold(strings.TrimSpace(scanner.Text()), "q")
+	}
+
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	defer func() {
+		signal.Stop(interrupts)
+		close(interrupts)
+	}()
+	go s.handleInterrupts(interrupts)
 
+	s.printPrompt(s.nextPrompt())
+
+	// Lines of SQL are collected until the text ends outside string
+	// literals, comments and trigger bodies
+	var pending []string
 	for scanner.Scan() {
-		input := strings.TrimSpace(scanner.Text())
+		pending = append(pending, scanner.Text())
+		input := strings.TrimSpace(strings.Join(pending, "\n"))
+		if input == "" {
+			pending = nil
+			s.printPrompt(s.nextPrompt())
+			continue
+		}
+		if !strings.HasPrefix(input, ".") && !database.Complete(input) {
+			s.printPrompt(continuationPrompt)
+			continue
+		}
+		pending = nil
+
+		if exit := s.execute(input); exit {
+			return
+		}
+		s.printPrompt(s.nextPrompt())
+	}
+}
+
+// execute runs one command, which Ctrl-C and the timeout interrupt, and
+// reports whether the session should end
+func (s *Session) execute(input string) bool {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	s.mu.Lock()
+	s.cancel = cancel
+	if timeout := s.commands.Timeout(); timeout > 0 {
+		s.left, s.resumed = timeout, time.Now()
+		s.timer = time.AfterFunc(timeout, func() {
+			cancel(fmt.Errorf("query timed out after %s", timeout))
+		})
+	}
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		if s.timer != nil {
+			s.timer.Stop()
+		}
+		s.cancel, s.timer = nil, nil
+		s.mu.Unlock()
+		cancel(nil)
+	}()
+
+	result, err := s.commands.ProcessCommand(ctx, input)
+	if err != nil {
+		fmt.Println("Error:", cancelled(ctx, err))
+		return false
+	}
+
+	// Check if we should exit
+	if result.Type == ExitCommand {
+		return true
+	}
 
-		result, err := s.commands.ProcessCommand(input)
+	s.handleCommandResult(ctx, result)
+	return false
+}
+
+// printStatements runs the statements of the input and prints the outcome
+// of each as it arrives
+func (s *Session) printStatements(ctx context.Context, statements iter.Seq2[*database.Statement, error]) {
+	for st, err := range statements {
 		if err != nil {
-			fmt.Println("Error:", err)
-			fmt.Print("sql> ")
+			fmt.Println("Error:", cancelled(ctx, err))
+			return
+		}
+		if st.Rows == nil {
+			s.formatter.PrintAffected(st.Result)
 			continue
 		}
+		// An error stopping the rows is reported by the statements
+		s.formatter.PrintRows(st.Rows)
+	}
+}
 
-		// Check if we should exit
-		if result.Type == ExitCommand {
-			return
+// handleInterrupts cancels the running command on Ctrl-C. At the prompt
+// Ctrl-C does not end the session, which .quit does.
+func (s *Session) handleInterrupts(interrupts <-chan os.Signal) {
+	for range interrupts {
+		s.mu.Lock()
+		cancel := s.cancel
+		s.mu.Unlock()
+
+		if cancel != nil {
+			cancel(errInterrupted)
+			continue
 		}
+		s.Notify("Use .quit to exit.")
+	}
+}
 
-		s.handleCommandResult(result)
-		fmt.Print("sql> ")
+// cancelled replaces the error of a cancelled command with the reason it
+// was cancelled
+func cancelled(ctx context.Context, err error) error {
+	if cause := context.Cause(ctx); cause != nil && ctx.Err() != nil {
+		return cause
 	}
+	return err
 }
 
 // handleCommandResult processes the result of a command
-func (s *Session) handleCommandResult(result CommandResult) {
+func (s *Session) handleCommandResult(ctx context.Context, result CommandResult) {
 	switch result.Type {
 	case ExitCommand:
 		return
-	case HelpCommand:
-		if helpText, ok := result.Data.(string); ok {
-			fmt.Println(helpText)
+	case HelpCommand, ImportCommand, TimeoutCommand, WorkspaceCommand, DefinitionCommand, SearchIndexCommand:
+		if message, ok := result.Data.(string); ok {
+			fmt.Println(message)
 		}
-	case TablesCommand, SchemaCommand, SQLQueryCommand:
-		if data, ok := result.Data.([][]string); ok {
-			s.lastResults = data
+	case TablesCommand, SchemaCommand:
+		if data, ok := result.Data.(*database.Result); ok {
 			s.formatter.PrintResults(data)
 		}
+	case SQLQueryCommand:
+		if statements, ok := result.Data.(iter.Seq2[*database.Statement, error]); ok {
+			s.printStatements(ctx, statements)
+		}
 	case MappingsCommand:
 		if mappings, ok := result.Data.(map[string]map[string]string); ok {
 			s.formatter.PrintMappings(mappings)
 		}
 	case ExportCommand:
 		if filename, ok := result.Data.(string); ok {
-			if s.lastResults != nil {
-				if err := s.formatter.ExportToCSV(filename, s.lastResults); err != nil {
-					fmt.Println("Error exporting to CSV:", err)
-				}
-			} else {
-				fmt.Println("No results to export. Run a SELECT query first.")
+			if err := s.formatter.ExportToCSV(filename); err != nil {
+				fmt.Println("Error exporting to CSV:", err)
 			}
 		}
 	}
@@ -0,0 +1,119 @@
+package zh
+
+import (
+	"cmp"
+	_ "embed"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// strokeTable lists the characters with each number of strokes, one count
+// per line, in the CLDR stroke order
+//
+//go:embed strokes.txt
+var strokeTable string
+
+// strokeRanks maps characters to their position in stroke order, built on
+// first use
+var strokeRanks = sync.OnceValue(func() map[rune]int {
+	m := make(map[rune]int, 28000)
+	for _, line := range strings.Split(strokeTable, "\n") {
+		_, chars, ok := strings.Cut(line, " ")
+		if !ok {
+			continue
+		}
+		for _, c := range chars {
+			m[c] = len(m) + 1
+		}
+	}
+	return m
+})
+
+// pinyinKey orders a character in pinyin order: by syllable, then tone,
+// then strokes
+type pinyinKey struct {
+	syllable string
+	tone     string
+	strokes  int
+}
+
+// pinyinKeys maps characters to their pinyin sort key, built on first use
+var pinyinKeys = sync.OnceValue(func() map[rune]pinyinKey {
+	ranks := strokeRanks()
+	m := make(map[rune]pinyinKey, len(readings()))
+	for c, syllable := range readings() {
+		numbered := spell(syllable, PinyinNumber)
+		plain := strings.TrimRight(numbered, "1234")
+		m[c] = pinyinKey{plain, numbered[len(plain):], ranks[c]}
+	}
+	return m
+})
+
+// ComparePinyin compares a and b as a Chinese dictionary orders words:
+// character by character, Chinese characters by their pinyin, characters
+// read alike by tone and then by strokes. Other characters, such as
+// letters and digits, come before Chinese ones in code point order. The
+// result is negative, zero or positive as in strings.Compare.
+func ComparePinyin(a, b string) int {
+	keys := pinyinKeys()
+	return compareRunes(a, b, func(x, y rune) (int, bool) {
+		kx, okx := keys[x]
+		ky, oky := keys[y]
+		if !okx || !oky {
+			return 0, false
+		}
+		return cmp.Or(
+			strings.Compare(kx.syllable, ky.syllable),
+			strings.Compare(kx.tone, ky.tone),
+			cmp.Compare(kx.strokes, ky.strokes),
+		), true
+	})
+}
+
+// CompareStrokes compares a and b character by character, Chinese
+// characters by their number of strokes and then the CLDR stroke order,
+// as names are listed in official documents. Other characters come first
+// in code point order. The result is as in strings.Compare.
+func CompareStrokes(a, b string) int {
+	ranks := strokeRanks()
+	return compareRunes(a, b, func(x, y rune) (int, bool) {
+		rx, okx := ranks[x]
+		ry, oky := ranks[y]
+		if !okx || !oky {
+			return 0, false
+		}
+		return cmp.Compare(rx, ry), true
+	})
+}
+
+// compareRunes compares two strings one character at a time. compareChinese
+// orders two characters it knows; other characters sort before known ones
+// and by code point among themselves.
+func compareRunes(a, b string, compareChinese func(x, y rune) (int, bool)) int {
+	for a != "" && b != "" {
+		x, nx := utf8.DecodeRuneInString(a)
+		y, ny := utf8.DecodeRuneInString(b)
+		a, b = a[nx:], b[ny:]
+		if x == y {
+			continue
+		}
+		if c, ok := compareChinese(x, y); ok {
+			if c != 0 {
+				return c
+			}
+			// Different characters read and written alike
+			return cmp.Compare(x, y)
+		}
+		_, knownX := compareChinese(x, x)
+		_, knownY := compareChinese(y, y)
+		switch {
+		case knownX && !knownY:
+			return 1
+		case knownY && !knownX:
+			return -1
+		}
+		return cmp.Compare(x, y)
+	}
+	return cmp.Compare(len(a), len(b))
+}
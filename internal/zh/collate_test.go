@@ -0,0 +1,32 @@
+package zh
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestCollations(t *testing.T) {
+	tests := []struct {
+		name    string
+		compare func(a, b string) int
+		in      []string
+		want    []string
+	}{
+		{"pinyin", ComparePinyin, []string{"张三", "李四", "王五", "阿里", "赵六", "Apple", "张", "吕布", "卢", "妈", "马"},
+			[]string{"Apple", "阿里", "李四", "卢", "吕布", "妈", "马", "王五", "张", "张三", "赵六"}},
+		{"strokes", CompareStrokes, []string{"王五", "丁一", "李四", "赵六", "一", "Z"},
+			[]string{"Z", "一", "丁一", "王五", "李四", "赵六"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := slices.SortedFunc(slices.Values(tt.in), tt.compare)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("sorted = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if ComparePinyin("北京", "北京") != 0 || CompareStrokes("北京", "北京") != 0 {
+		t.Error("equal strings should compare equal")
+	}
+}
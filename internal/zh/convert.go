@@ -0,0 +1,82 @@
+package zh
+
+import (
+	_ "embed"
+	"strings"
+	"sync"
+)
+
+// Character tables of the simplified and traditional conversions, one pair
+// of characters per line: the character and what it converts to
+var (
+	//go:embed t2s.txt
+	t2sTable string
+	//go:embed s2t.txt
+	s2tTable string
+)
+
+var (
+	toSimplified  = sync.OnceValue(func() map[rune]rune { return parsePairs(t2sTable) })
+	toTraditional = sync.OnceValue(func() map[rune]rune { return parsePairs(s2tTable) })
+)
+
+// parsePairs reads a character table
+func parsePairs(table string) map[rune]rune {
+	m := make(map[rune]rune, 3000)
+	for _, line := range strings.Split(table, "\n") {
+		if pair := []rune(line); len(pair) == 2 {
+			m[pair[0]] = pair[1]
+		}
+	}
+	return m
+}
+
+// ToSimplified converts traditional characters to simplified ones, e.g.
+// 發展 to 发展. Words such as 乾隆, whose characters are not simplified as
+// they would be elsewhere, are kept.
+func ToSimplified(s string) string {
+	return convert(s, toSimplified(), simplifiedPhrases())
+}
+
+// ToTraditional converts simplified characters to traditional ones. A
+// simplified character standing for several traditional ones, like 发 for
+// 發 and 髮, becomes the one of the word it is part of where the word is
+// listed, as in 头发 (頭髮), and the most common one otherwise.
+func ToTraditional(s string) string {
+	return convert(s, toTraditional(), traditionalPhrases())
+}
+
+func convert(s string, table map[rune]rune, words *phrases[[]rune]) string {
+	text := []rune(s)
+	var b strings.Builder
+	b.Grow(len(s))
+	for i := 0; i < len(text); {
+		if to, n := words.match(text[i:]); n > 0 {
+			b.WriteString(string(to))
+			i += n
+			continue
+		}
+		if to, ok := table[text[i]]; ok {
+			b.WriteRune(to)
+		} else {
+			b.WriteRune(text[i])
+		}
+		i++
+	}
+	return b.String()
+}
+
+// ToHalfwidth converts full-width letters, digits, punctuation and the
+// ideographic space to their ASCII forms, e.g. ＡＢＣ１２３，to ABC123,.
+// Chinese punctuation without an ASCII form, such as 。and 、, is kept.
+func ToHalfwidth(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == '　':
+			return ' '
+		case '！' <= r && r <= '～':
+			return r - 0xFEE0
+		}
+		return r
+	}, s)
+}
@@ -0,0 +1,270 @@
+// Package zh handles text in the formats common in Chinese data: dates,
+// numbers, pinyin, identity card numbers and the conversion between
+// simplified and traditional characters.
+package zh
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Layouts of the ISO-8601 text written for recognised dates. SQLite's date
+// and time functions accept all of them, and they sort chronologically.
+const (
+	isoDate         = "2006-01-02"
+	isoDateTime     = "2006-01-02 15:04:05.999"
+	isoDateTimeZone = "2006-01-02 15:04:05.999-07:00"
+)
+
+// excelEpoch is day zero of Excel serial dates (Excel counts 1900 as a leap year)
+var excelEpoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+var (
+	// datePart matches a date at the start of a value, e.g. 2024年3月5日,
+	// 2024/3/5, 24-03-05 or 2024-03. The groups are year, first separator,
+	// month, second separator and day.
+	datePart = regexp.MustCompile(`^(\d{4}|\d{2})\s*(年|-|/|\.)\s*(\d{1,2})\s*(月|-|/|\.)?\s*(?:(\d{1,2})\s*[日号]?)?`)
+	// timePart matches the time following a date, e.g. 15:04:05, 下午3:04,
+	// 3点30分 or 3:04 PM, with an optional zone offset
+	timePart = regexp.MustCompile(`^(上午|下午|中午|晚上|凌晨|早上|AM|PM)?\s*(\d{1,2})\s*(:|时|点)\s*(?:(\d{1,2})\s*分?\s*(?:[:]?\s*(\d{1,2})(?:\.(\d{1,9}))?\s*秒?)?)?\s*(上午|下午|AM|PM)?\s*(Z|[+-]\d{2}:?\d{2})?$`)
+	// weekday matches a day of the week written after a date, e.g. (星期二)
+	weekday = regexp.MustCompile(`[(（]?(星期|周|礼拜)[一二三四五六日天][)）]?`)
+	// chineseNumber matches numbers written with Chinese numerals
+	chineseNumber = regexp.MustCompile(`[〇零一二三四五六七八九十]+`)
+	// serialNumber matches an Excel serial date such as 45356 or 45356.5
+	serialNumber = regexp.MustCompile(`^\d+(\.\d+)?$`)
+)
+
+// DateParser recognises dates and times in the formats common in Chinese
+// data and renders them as ISO-8601 text
+type DateParser struct {
+	// Layouts are Go time layouts tried before the built-in formats
+	Layouts []string
+	// Location is the time zone of times without an offset. When set, times
+	// are converted to it and written with their offset; otherwise they are
+	// written without one.
+	Location *time.Location
+}
+
+// Parse returns the ISO-8601 form of a date or time value. Excel serial
+// numbers are only recognised with serials set, as they cannot be told
+// apart from other numbers.
+func (p *DateParser) Parse(value string, serials bool) (string, bool) {
+	s := strings.TrimSpace(norm.NFKC.String(value))
+	if s == "" {
+		return "", false
+	}
+
+	for _, layout := range p.Layouts {
+		loc := p.Location
+		if loc == nil {
+			loc = time.UTC
+		}
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return p.format(t, strings.Contains(layout, "04"), hasZone(layout)), true
+		}
+	}
+
+	if serials && serialNumber.MatchString(s) {
+		return p.parseSerial(s)
+	}
+	return p.parseText(s)
+}
+
+// parseSerial converts an Excel serial date, whose fraction is the time of day
+func (p *DateParser) parseSerial(s string) (string, bool) {
+	serial, err := strconv.ParseFloat(s, 64)
+	if err != nil || serial < 1 || serial >= 2958466 { // 9999-12-31 is the last Excel date
+		return "", false
+	}
+	days, fraction := math.Modf(serial)
+	t := excelEpoch.AddDate(0, 0, int(days)).Add(time.Duration(math.Round(fraction*86400)) * time.Second)
+	if fraction == 0 {
+		return t.Format(isoDate), true
+	}
+	return p.format(time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, p.location()), true, false), true
+}
+
+// parseText recognises the built-in textual date formats
+func (p *DateParser) parseText(s string) (string, bool) {
+	s = weekday.ReplaceAllString(s, " ")
+	s = chineseNumber.ReplaceAllStringFunc(s, chineseToArabic)
+
+	m := datePart.FindStringSubmatch(s)
+	if m == nil {
+		return "", false
+	}
+	yearText, sep1, monthText, sep2, dayText := m[1], m[2], m[3], m[4], m[5]
+	rest := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(s[len(m[0]):]), "T"))
+
+	switch {
+	case sep1 == "年" && sep2 != "月":
+		return "", false
+	case sep1 != "年" && dayText != "" && sep2 != sep1:
+		// Mixed separators such as 2024-03/05
+		return "", false
+	case dayText == "" && sep2 != "月" && !(sep1 == "-" && sep2 == "" && len(yearText) == 4 && len(monthText) == 2):
+		// Without a day only 2024年3月 and 2024-03 are dates; 2024.5 is a number
+		return "", false
+	case len(yearText) == 2 && dayText == "":
+		return "", false
+	}
+
+	year, _ := strconv.Atoi(yearText)
+	if len(yearText) == 2 {
+		// Two digit years follow the POSIX convention: 69-99 are 1969-1999
+		if year < 69 {
+			year += 2000
+		} else {
+			year += 1900
+		}
+	}
+	month, _ := strconv.Atoi(monthText)
+	day := 1
+	if dayText != "" {
+		day, _ = strconv.Atoi(dayText)
+	}
+	if !validDate(year, month, day) {
+		return "", false
+	}
+
+	if rest == "" {
+		return time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC).Format(isoDate), true
+	}
+	if dayText == "" {
+		return "", false
+	}
+
+	t, zoned, ok := p.parseTime(rest, year, month, day)
+	if !ok {
+		return "", false
+	}
+	return p.format(t, true, zoned), true
+}
+
+// parseTime parses the time of day following a date
+func (p *DateParser) parseTime(s string, year, month, day int) (t time.Time, zoned, ok bool) {
+	m := timePart.FindStringSubmatch(strings.ReplaceAll(strings.ToUpper(s), "：", ":"))
+	if m == nil {
+		return t, false, false
+	}
+	marker, hourText, minuteText, secondText, fractionText := m[1]+m[7], m[2], m[4], m[5], m[6]
+	if m[3] == ":" && minuteText == "" {
+		return t, false, false
+	}
+
+	hour, _ := strconv.Atoi(hourText)
+	minute, _ := strconv.Atoi(minuteText)
+	second, _ := strconv.Atoi(secondText)
+	nanos := 0
+	if fractionText != "" {
+		nanos, _ = strconv.Atoi((fractionText + "00000000")[:9])
+	}
+
+	switch marker {
+	case "下午", "晚上", "PM":
+		if hour < 12 {
+			hour += 12
+		}
+	case "中午":
+		if hour < 11 {
+			hour += 12
+		}
+	case "上午", "凌晨", "早上", "AM":
+		if hour == 12 {
+			hour = 0
+		}
+	}
+	if hour > 23 || minute > 59 || second > 59 {
+		return t, false, false
+	}
+
+	loc := p.location()
+	if offset := m[8]; offset != "" {
+		zone, err := time.Parse("-07:00", normalizeOffset(offset))
+		if err != nil {
+			return t, false, false
+		}
+		loc, zoned = zone.Location(), true
+	}
+	return time.Date(year, time.Month(month), day, hour, minute, second, nanos, loc), zoned, true
+}
+
+// format renders a parsed time, converting it to the configured zone
+func (p *DateParser) format(t time.Time, withTime, zoned bool) string {
+	switch {
+	case !withTime:
+		return t.Format(isoDate)
+	case p.Location != nil:
+		return t.In(p.Location).Format(isoDateTimeZone)
+	case zoned:
+		return t.Format(isoDateTimeZone)
+	default:
+		return t.Format(isoDateTime)
+	}
+}
+
+// location returns the zone of times without an offset
+func (p *DateParser) location() *time.Location {
+	if p.Location != nil {
+		return p.Location
+	}
+	return time.UTC
+}
+
+// validDate reports whether year, month and day form a real calendar date
+func validDate(year, month, day int) bool {
+	t := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+	return month >= 1 && month <= 12 && t.Day() == day && t.Month() == time.Month(month)
+}
+
+// hasZone reports whether a Go time layout parses a zone
+func hasZone(layout string) bool {
+	return strings.Contains(layout, "Z07") || strings.Contains(layout, "-07") || strings.Contains(layout, "MST")
+}
+
+// normalizeOffset turns Z, +0800 and +08:00 into the form +08:00
+func normalizeOffset(offset string) string {
+	if offset == "Z" {
+		return "+00:00"
+	}
+	if !strings.Contains(offset, ":") {
+		return offset[:3] + ":" + offset[3:]
+	}
+	return offset
+}
+
+// chineseDigits maps Chinese numerals to their values
+var chineseDigits = map[rune]int{'〇': 0, '零': 0, '一': 1, '二': 2, '三': 3, '四': 4, '五': 5, '六': 6, '七': 7, '八': 8, '九': 9}
+
+// chineseToArabic converts a number written with Chinese numerals. Numbers
+// with 十 are read as values (二十五 is 25), others digit by digit
+// (二〇二四 is 2024).
+func chineseToArabic(s string) string {
+	tens, units, found := strings.Cut(s, "十")
+	if !found {
+		var b strings.Builder
+		for _, r := range s {
+			b.WriteString(strconv.Itoa(chineseDigits[r]))
+		}
+		return b.String()
+	}
+
+	value := 10
+	if tens != "" {
+		value = 0
+		for _, r := range tens {
+			value = value*10 + chineseDigits[r]
+		}
+		value *= 10
+	}
+	for _, r := range units {
+		value += chineseDigits[r]
+	}
+	return strconv.Itoa(value)
+}
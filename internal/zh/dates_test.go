@@ -0,0 +1,52 @@
+package zh
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDateParser(t *testing.T) {
+	shanghai := time.FixedZone("CST", 8*3600)
+
+	tests := []struct {
+		name    string
+		parser  DateParser
+		in      string
+		serials bool
+		want    string
+		ok      bool
+	}{
+		{"chinese date", DateParser{}, "2024年3月5日", false, "2024-03-05", true},
+		{"chinese month", DateParser{}, "2024年3月", false, "2024-03-01", true},
+		{"chinese numerals", DateParser{}, "二〇二四年三月", false, "2024-03-01", true},
+		{"chinese numerals with tens", DateParser{}, "二〇二四年十二月二十五日", false, "2024-12-25", true},
+		{"weekday", DateParser{}, "2024年3月5日（星期二）", false, "2024-03-05", true},
+		{"full-width digits", DateParser{}, "２０２４年３月５日", false, "2024-03-05", true},
+		{"afternoon", DateParser{}, "2024/3/5 下午3:04", false, "2024-03-05 15:04:00", true},
+		{"morning twelve", DateParser{}, "2024/3/5 上午12:30", false, "2024-03-05 00:30:00", true},
+		{"chinese time", DateParser{}, "2024年3月5日 15时04分05秒", false, "2024-03-05 15:04:05", true},
+		{"o'clock", DateParser{}, "2024-03-05 晚上8点", false, "2024-03-05 20:00:00", true},
+		{"two digit year", DateParser{}, "24-03-05", false, "2024-03-05", true},
+		{"iso month", DateParser{}, "2024-03", false, "2024-03-01", true},
+		{"iso with offset", DateParser{}, "2024-03-05T15:04:05+08:00", false, "2024-03-05 15:04:05+08:00", true},
+		{"fraction", DateParser{}, "2024-03-05 15:04:05.250", false, "2024-03-05 15:04:05.25", true},
+		{"time zone", DateParser{Location: shanghai}, "2024-03-05 15:04", false, "2024-03-05 15:04:00+08:00", true},
+		{"converted to zone", DateParser{Location: shanghai}, "2024-03-05T07:04:00Z", false, "2024-03-05 15:04:00+08:00", true},
+		{"custom layout", DateParser{Layouts: []string{"02.01.2006"}}, "05.03.2024", false, "2024-03-05", true},
+		{"excel serial", DateParser{}, "45356", true, "2024-03-05", true},
+		{"excel serial with time", DateParser{}, "45356.5", true, "2024-03-05 12:00:00", true},
+		{"serial needs opt-in", DateParser{}, "45356", false, "", false},
+		{"invalid day", DateParser{}, "2024-02-30", false, "", false},
+		{"decimal number", DateParser{}, "2024.5", false, "", false},
+		{"mixed separators", DateParser{}, "2024-03/05", false, "", false},
+		{"text", DateParser{}, "张三", false, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := tt.parser.Parse(tt.in, tt.serials)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("Parse(%q) = %q, %v, want %q, %v", tt.in, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+//go:build ignore
+
+// gen_tables writes the character tables embedded by this package using
+// the transliterators of ICU's uconv and the CLDR stroke order shipped with
+// Perl's Unicode::Collate, which must be installed:
+//
+//	go generate ./internal/zh
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// hanRanges are the blocks of CJK Unified Ideographs covered by the tables:
+// Extension A and the basic block
+var hanRanges = [][2]rune{{0x3400, 0x4DBF}, {0x4E00, 0x9FFF}}
+
+func main() {
+	var chars []rune
+	for _, r := range hanRanges {
+		for c := r[0]; c <= r[1]; c++ {
+			chars = append(chars, c)
+		}
+	}
+
+	readings := transliterate(chars, "Han-Latin")
+	bySyllable := make(map[string][]rune)
+	for i, c := range chars {
+		if syllable := readings[i]; syllable != string(c) && syllable != "" {
+			bySyllable[syllable] = append(bySyllable[syllable], c)
+		}
+	}
+	syllables := make([]string, 0, len(bySyllable))
+	for syllable := range bySyllable {
+		syllables = append(syllables, syllable)
+	}
+	slices.Sort(syllables)
+	var pinyin strings.Builder
+	for _, syllable := range syllables {
+		fmt.Fprintf(&pinyin, "%s %s\n", syllable, string(bySyllable[syllable]))
+	}
+	write("pinyin.txt", pinyin.String())
+
+	write("t2s.txt", pairs(chars, transliterate(chars, "Hant-Hans")))
+	write("s2t.txt", pairs(chars, transliterate(chars, "Hans-Hant")))
+	write("strokes.txt", strokes())
+}
+
+// transliterate converts each character on its own
+func transliterate(chars []rune, transliterator string) []string {
+	var input strings.Builder
+	for _, c := range chars {
+		input.WriteRune(c)
+		input.WriteByte('\n')
+	}
+	cmd := exec.Command("uconv", "-f", "utf-8", "-t", "utf-8", "-x", transliterator)
+	cmd.Stdin = strings.NewReader(input.String())
+	out, err := cmd.Output()
+	if err != nil {
+		log.Fatalf("uconv -x %s: %v", transliterator, err)
+	}
+
+	var lines []string
+	scanner := bufio.NewScanner(strings.NewReader(string(out)))
+	for scanner.Scan() {
+		lines = append(lines, strings.TrimSpace(scanner.Text()))
+	}
+	if len(lines) != len(chars) {
+		log.Fatalf("uconv -x %s returned %d lines for %d characters", transliterator, len(lines), len(chars))
+	}
+	return lines
+}
+
+// pairs lists the characters converted to a different single character,
+// one pair per line
+func pairs(chars []rune, converted []string) string {
+	var b strings.Builder
+	for i, c := range chars {
+		to, size := utf8.DecodeRuneInString(converted[i])
+		if size == len(converted[i]) && to != c {
+			fmt.Fprintf(&b, "%c%c\n", c, to)
+		}
+	}
+	return b.String()
+}
+
+// strokes lists the characters by their number of strokes, one line per
+// count, each line in CLDR stroke order
+func strokes() string {
+	out, err := exec.Command("perl", "-MUnicode::Collate::CJK::Stroke", "-e", `print $INC{"Unicode/Collate/CJK/Stroke.pm"}`).Output()
+	if err != nil {
+		log.Fatalf("perl Unicode::Collate::CJK::Stroke: %v", err)
+	}
+	data, err := os.ReadFile(string(out))
+	if err != nil {
+		log.Fatal(err)
+	}
+	_, list, _ := strings.Cut(string(data), "__DATA__\n")
+	list, _, _ = strings.Cut(list, "__END__")
+
+	// Markers FDD0-28xx start the characters of xx strokes
+	var b strings.Builder
+	for _, field := range strings.Fields(list) {
+		if count, ok := strings.CutPrefix(field, "FDD0-28"); ok {
+			n, err := strconv.ParseUint(count, 16, 8)
+			if err != nil {
+				log.Fatalf("stroke marker %s: %v", field, err)
+			}
+			if b.Len() > 0 {
+				b.WriteByte('\n')
+			}
+			fmt.Fprintf(&b, "%d ", n)
+			continue
+		}
+		code, err := strconv.ParseUint(field, 16, 32)
+		if err != nil {
+			continue
+		}
+		for _, r := range hanRanges {
+			if c := rune(code); r[0] <= c && c <= r[1] {
+				b.WriteRune(c)
+			}
+		}
+	}
+	b.WriteByte('\n')
+	return b.String()
+}
+
+func write(name, content string) {
+	if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
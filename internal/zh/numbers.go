@@ -0,0 +1,146 @@
+package zh
+
+import (
+	"strconv"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// numeralDigits maps Chinese digits, including the financial forms used on
+// invoices (大写), to their values
+var numeralDigits = map[rune]float64{
+	'〇': 0, '零': 0,
+	'一': 1, '壹': 1, '幺': 1,
+	'二': 2, '贰': 2, '貳': 2, '两': 2, '兩': 2,
+	'三': 3, '叁': 3, '參': 3,
+	'四': 4, '肆': 4,
+	'五': 5, '伍': 5,
+	'六': 6, '陆': 6, '陸': 6,
+	'七': 7, '柒': 7,
+	'八': 8, '捌': 8,
+	'九': 9, '玖': 9,
+}
+
+// numeralUnits maps the units within a section of four digits
+var numeralUnits = map[rune]float64{'十': 10, '拾': 10, '百': 100, '佰': 100, '千': 1000, '仟': 1000}
+
+// numeralSections maps the units ending a section
+var numeralSections = map[rune]float64{'万': 1e4, '萬': 1e4, '亿': 1e8, '億': 1e8}
+
+// ParseNumber reads a number written with Chinese numerals, Arabic digits
+// or both, such as 一万二千三, 壹仟贰佰元整, 三点一四, 负五 or 1.5亿. As in
+// speech, a digit right after a unit counts in the next lower unit, so
+// 一万二千三 is 12300 while 一万二千零三 is 12003.
+func ParseNumber(s string) (float64, bool) {
+	s = strings.ReplaceAll(strings.TrimSpace(norm.NFKC.String(s)), ",", "")
+	// Amounts written out in full end in 元整
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "整"), "元")
+	if s == "" {
+		return 0, false
+	}
+	if n, err := strconv.ParseFloat(s, 64); err == nil {
+		return n, true
+	}
+
+	sign := 1.0
+	if rest, ok := strings.CutPrefix(s, "负"); ok {
+		s, sign = rest, -1
+	} else if rest, ok := strings.CutPrefix(s, "-"); ok {
+		s, sign = rest, -1
+	}
+
+	integer, fraction, hasFraction := strings.Cut(s, "点")
+	n, ok := parseInteger(integer)
+	if !ok {
+		return 0, false
+	}
+	if hasFraction {
+		// Digits after 点 are read one by one
+		var digits strings.Builder
+		for _, c := range fraction {
+			d, ok := numeralDigits[c]
+			if !ok {
+				return 0, false
+			}
+			digits.WriteByte('0' + byte(d))
+		}
+		n, _ = strconv.ParseFloat(strconv.FormatFloat(n, 'f', -1, 64)+"."+digits.String(), 64)
+	}
+	return sign * n, true
+}
+
+// parseInteger reads the part of a number before 点
+func parseInteger(s string) (float64, bool) {
+	if s == "" {
+		return 0, false
+	}
+
+	var total, section float64
+	var biggest float64          // largest section unit so far
+	var added, addedUnit float64 // amount the last section unit added to total, and that unit
+	var lastUnit float64
+	number, digits := 0.0, 0 // digits pending before the next unit
+	zero := false            // a 零 stands between the pending digits and the last unit
+	afterUnit := false
+
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+		if d, ok := numeralDigits[c]; ok {
+			if d == 0 {
+				zero = true
+			}
+			number, digits = number*10+d, digits+1
+			continue
+		}
+		if '0' <= c && c <= '9' {
+			// Arabic digits, possibly with a decimal point, such as 1.5亿
+			j := i
+			for j < len(runes) && (('0' <= runes[j] && runes[j] <= '9') || runes[j] == '.') {
+				j++
+			}
+			n, err := strconv.ParseFloat(string(runes[i:j]), 64)
+			if err != nil {
+				return 0, false
+			}
+			number, digits, zero, afterUnit = n, digits+j-i, false, false
+			i = j - 1
+			continue
+		}
+
+		if unit, ok := numeralUnits[c]; ok {
+			if digits == 0 {
+				number = 1 // 十五 is 15
+			}
+			section += number * unit
+		} else if unit, ok := numeralSections[c]; ok {
+			section += number
+			switch {
+			case digits == 0 && i > 0 && numeralSections[runes[i-1]] > 0:
+				// 一万万: a repeated section unit multiplies the last section
+				total += added * (unit - 1)
+				added, addedUnit = added*unit, addedUnit*unit
+				biggest = max(biggest, addedUnit)
+			case unit > biggest:
+				// 一万亿: the section unit applies to everything before it
+				added, addedUnit = (total+section)*unit, unit
+				total, biggest = added, unit
+			default:
+				added, addedUnit = section*unit, unit
+				total += added
+			}
+			section = 0
+		} else {
+			return 0, false
+		}
+		lastUnit = numeralUnits[c] + numeralSections[c]
+		number, digits, zero, afterUnit = 0, 0, false, true
+	}
+
+	if digits == 1 && afterUnit && !zero && lastUnit >= 10 {
+		// 二千三 is 2300 and 一万二 is 12000
+		number *= lastUnit / 10
+	}
+	return total + section + number, true
+}
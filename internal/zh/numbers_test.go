@@ -0,0 +1,42 @@
+package zh
+
+import "testing"
+
+func TestParseNumber(t *testing.T) {
+	tests := []struct {
+		in   string
+		want float64
+		ok   bool
+	}{
+		{"一万二千三", 12300, true},
+		{"一万二千零三", 12003, true},
+		{"一万二", 12000, true},
+		{"十五", 15, true},
+		{"二十", 20, true},
+		{"一百零八", 108, true},
+		{"十万", 100000, true},
+		{"两千", 2000, true},
+		{"一亿二千万", 120000000, true},
+		{"一万亿", 1e12, true},
+		{"一万万", 1e8, true},
+		{"三万万五千万", 350000000, true},
+		{"二〇二四", 2024, true},
+		{"壹仟贰佰叁拾肆元整", 1234, true},
+		{"三点一四", 3.14, true},
+		{"负五", -5, true},
+		{"1.5亿", 150000000, true},
+		{"3万5千", 35000, true},
+		{"１,２３４", 1234, true},
+		{"", 0, false},
+		{"三个", 0, false},
+		{"张三", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, ok := ParseNumber(tt.in)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("ParseNumber(%q) = %v, %v, want %v, %v", tt.in, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package zh
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// idCardWeights are the weights of the first 17 digits of an 18 digit
+// identity card number in its check digit (GB 11643-1999)
+var idCardWeights = [17]int{7, 9, 10, 5, 8, 4, 2, 1, 6, 3, 7, 9, 10, 5, 8, 4, 2}
+
+// idCardCheckDigits maps the weighted sum modulo 11 to the check digit
+const idCardCheckDigits = "10X98765432"
+
+var (
+	// idCard18 and idCard15 match the current and the first generation
+	// identity card numbers
+	idCard18 = regexp.MustCompile(`^\d{17}[\dX]$`)
+	idCard15 = regexp.MustCompile(`^\d{15}$`)
+	// mobileNumber matches a mainland mobile number not part of a longer
+	// number, optionally with +86 and separated as 138-1234-5678; the groups
+	// keep all but the middle four digits
+	mobileNumber = regexp.MustCompile(`(^|\D)((?:\+?86[- ]?)?1[3-9]\d)([- ]?)\d{4}([- ]?)(\d{4})(\D|$)`)
+)
+
+// IDCard holds what a resident identity card number (居民身份证号码) tells
+type IDCard struct {
+	Birthdate time.Time
+	Male      bool
+}
+
+// ParseIDCard checks a resident identity card number, 18 digits with a
+// valid check digit or the 15 digits of first generation cards, and reads
+// the birthdate and gender it encodes
+func ParseIDCard(s string) (IDCard, bool) {
+	s = strings.ToUpper(strings.TrimSpace(norm.NFKC.String(s)))
+
+	var birth, sequence string
+	switch {
+	case idCard18.MatchString(s):
+		sum := 0
+		for i, w := range idCardWeights {
+			sum += int(s[i]-'0') * w
+		}
+		if idCardCheckDigits[sum%11] != s[17] {
+			return IDCard{}, false
+		}
+		birth, sequence = s[6:14], s[14:17]
+	case idCard15.MatchString(s):
+		// First generation cards write the year without its century
+		birth, sequence = "19"+s[6:12], s[12:15]
+	default:
+		return IDCard{}, false
+	}
+
+	birthdate, err := time.Parse("20060102", birth)
+	if err != nil {
+		return IDCard{}, false
+	}
+	// Odd sequence numbers are given to men
+	return IDCard{Birthdate: birthdate, Male: (sequence[2]-'0')%2 == 1}, true
+}
+
+// MaskPhone hides the middle four digits of the mainland mobile numbers in
+// s, e.g. 13812345678 becomes 138****5678. Other text is kept.
+func MaskPhone(s string) string {
+	// Adjacent numbers share their separator, so replace until stable
+	for {
+		masked := mobileNumber.ReplaceAllString(s, "${1}${2}${3}****${4}${5}${6}")
+		if masked == s {
+			return masked
+		}
+		s = masked
+	}
+}
@@ -0,0 +1,56 @@
+package zh
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseIDCard(t *testing.T) {
+	tests := []struct {
+		name      string
+		in        string
+		birthdate string
+		male      bool
+		ok        bool
+	}{
+		{"valid", "11010519491231002X", "1949-12-31", false, true},
+		{"lower-case x", "11010519491231002x", "1949-12-31", false, true},
+		{"male", "110101199003074477", "1990-03-07", true, true},
+		{"first generation", "110105491231002", "1949-12-31", false, true},
+		{"wrong check digit", "110105194912310021", "", false, false},
+		{"invalid birthdate", "110105194913310025", "", false, false},
+		{"too short", "1101051949", "", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			card, ok := ParseIDCard(tt.in)
+			if ok != tt.ok {
+				t.Fatalf("ParseIDCard(%q) ok = %v, want %v", tt.in, ok, tt.ok)
+			}
+			if !ok {
+				return
+			}
+			if got := card.Birthdate.Format(time.DateOnly); got != tt.birthdate || card.Male != tt.male {
+				t.Errorf("ParseIDCard(%q) = %s, male %v, want %s, male %v", tt.in, got, card.Male, tt.birthdate, tt.male)
+			}
+		})
+	}
+}
+
+func TestMaskPhone(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"13812345678", "138****5678"},
+		{"+86 138-1234-5678", "+86 138-****-5678"},
+		{"电话13812345678,13912345678", "电话138****5678,139****5678"},
+		{"订单号 213812345678", "订单号 213812345678"},
+		{"010-12345678", "010-12345678"},
+	}
+	for _, tt := range tests {
+		if got := MaskPhone(tt.in); got != tt.want {
+			t.Errorf("MaskPhone(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package zh
+
+import (
+	_ "embed"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Phrase tables list words whose reading or conversion differs from that of
+// their characters, such as 银行 (yín háng, not yín xíng) or 皇后 (not 皇後).
+// Each line holds a word, a space and its reading or conversion. Unlike the
+// character tables they are maintained by hand.
+var (
+	//go:embed pinyin_phrases.txt
+	pinyinPhraseTable string
+	//go:embed t2s_phrases.txt
+	t2sPhraseTable string
+	//go:embed s2t_phrases.txt
+	s2tPhraseTable string
+)
+
+var (
+	pinyinPhrases = sync.OnceValue(func() *phrases[[]string] {
+		return parsePhrases(pinyinPhraseTable, strings.Fields)
+	})
+	simplifiedPhrases = sync.OnceValue(func() *phrases[[]rune] {
+		return parsePhrases(t2sPhraseTable, func(s string) []rune { return []rune(s) })
+	})
+	traditionalPhrases = sync.OnceValue(func() *phrases[[]rune] {
+		return parsePhrases(s2tPhraseTable, func(s string) []rune { return []rune(s) })
+	})
+)
+
+// phrases maps words to a value, such as their syllables
+type phrases[V any] struct {
+	words   map[string]V
+	longest int // length of the longest word in characters
+}
+
+// parsePhrases reads a phrase table, converting each value with parse
+func parsePhrases[V any](table string, parse func(string) V) *phrases[V] {
+	p := &phrases[V]{words: make(map[string]V)}
+	for _, line := range strings.Split(table, "\n") {
+		word, value, ok := strings.Cut(strings.TrimSpace(line), " ")
+		if !ok {
+			continue
+		}
+		p.words[word] = parse(value)
+		p.longest = max(p.longest, utf8.RuneCountInString(word))
+	}
+	return p
+}
+
+// match finds the longest word at the start of text and returns its value
+// and length in characters, or 0 if no word starts there
+func (p *phrases[V]) match(text []rune) (V, int) {
+	for n := min(p.longest, len(text)); n >= 2; n-- {
+		if v, ok := p.words[string(text[:n])]; ok {
+			return v, n
+		}
+	}
+	var none V
+	return none, 0
+}
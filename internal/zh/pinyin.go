@@ -0,0 +1,138 @@
+package zh
+
+//go:generate go run gen_tables.go
+
+import (
+	_ "embed"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// pinyinTable lists each syllable with tone marks followed by the
+// characters read that way, one syllable per line
+//
+//go:embed pinyin.txt
+var pinyinTable string
+
+// readings maps characters to their syllable, built on first use
+var readings = sync.OnceValue(func() map[rune]string {
+	m := make(map[rune]string, 28000)
+	for _, line := range strings.Split(pinyinTable, "\n") {
+		syllable, chars, ok := strings.Cut(line, " ")
+		if !ok {
+			continue
+		}
+		for _, c := range chars {
+			m[c] = syllable
+		}
+	}
+	return m
+})
+
+// PinyinStyle selects how tones are written
+type PinyinStyle int
+
+const (
+	// PinyinPlain drops tones and writes ü as v: zhang san, lv
+	PinyinPlain PinyinStyle = iota
+	// PinyinTone writes tone marks: zhāng sān, lǜ
+	PinyinTone
+	// PinyinNumber writes the tone as a digit after the syllable: zhang1 san1, lv4
+	PinyinNumber
+)
+
+// toneMarks maps the combining marks of decomposed pinyin to their tone
+var toneMarks = map[rune]int{'̄': 1, '́': 2, '̌': 3, '̀': 4}
+
+// Pinyin spells the Chinese characters of s in pinyin, one syllable per
+// character separated by spaces. Common words and place names with a
+// reading of their own, such as 重庆 (chong qing), are read as words; other
+// characters get their most common reading. Other text is kept, separated
+// from the syllables by spaces.
+func Pinyin(s string, style PinyinStyle) string {
+	var words []string
+	var other strings.Builder
+	flush := func() {
+		if text := strings.TrimSpace(other.String()); text != "" {
+			words = append(words, text)
+		}
+		other.Reset()
+	}
+
+	read(s, func(c rune, syllable string) {
+		if syllable == "" {
+			other.WriteRune(c)
+			return
+		}
+		flush()
+		words = append(words, spell(syllable, style))
+	})
+	flush()
+	return strings.Join(words, " ")
+}
+
+// PinyinInitials returns the first letter of the pinyin of each Chinese
+// character in s, e.g. zs for 张三. Other characters except spaces are kept.
+func PinyinInitials(s string) string {
+	var b strings.Builder
+	read(s, func(c rune, syllable string) {
+		switch {
+		case syllable != "":
+			b.WriteString(spell(syllable, PinyinPlain)[:1])
+		case !unicode.IsSpace(c):
+			b.WriteRune(c)
+		}
+	})
+	return b.String()
+}
+
+// read calls fn with every character of s and its syllable, taken from the
+// word the character is part of where one matches; the syllable is empty
+// for characters that are not Chinese
+func read(s string, fn func(c rune, syllable string)) {
+	table := readings()
+	words := pinyinPhrases()
+	text := []rune(s)
+	for i := 0; i < len(text); {
+		if syllables, n := words.match(text[i:]); n > 0 {
+			for j := range n {
+				fn(text[i+j], syllables[j])
+			}
+			i += n
+			continue
+		}
+		fn(text[i], table[text[i]])
+		i++
+	}
+}
+
+// spell writes a syllable with tone marks in the given style
+func spell(syllable string, style PinyinStyle) string {
+	if style == PinyinTone {
+		return syllable
+	}
+
+	var letters []rune
+	tone := 0
+	for _, c := range norm.NFD.String(syllable) {
+		switch {
+		case toneMarks[c] != 0:
+			tone = toneMarks[c]
+		case c == '̈' && len(letters) > 0 && letters[len(letters)-1] == 'u':
+			// ü is written as v
+			letters[len(letters)-1] = 'v'
+		case unicode.Is(unicode.Mn, c):
+		default:
+			letters = append(letters, c)
+		}
+	}
+	plain := string(letters)
+	if style == PinyinNumber && tone > 0 {
+		return plain + strconv.Itoa(tone)
+	}
+	return plain
+}
@@ -0,0 +1,79 @@
+package zh
+
+import "testing"
+
+func TestPinyin(t *testing.T) {
+	tests := []struct {
+		in    string
+		style PinyinStyle
+		want  string
+	}{
+		{"张三", PinyinPlain, "zhang san"},
+		{"张三", PinyinTone, "zhāng sān"},
+		{"张三", PinyinNumber, "zhang1 san1"},
+		{"绿", PinyinPlain, "lv"},
+		{"绿", PinyinNumber, "lv4"},
+		{"吧", PinyinNumber, "ba"},
+		{"王 Li，先生", PinyinPlain, "wang Li， xian sheng"},
+		{"ABC", PinyinPlain, "ABC"},
+		{"重庆", PinyinPlain, "chong qing"},
+		{"长沙银行", PinyinTone, "cháng shā yín háng"},
+		{"中国银行行长", PinyinPlain, "zhong guo yin hang hang zhang"},
+		{"厦门 Xiamen", PinyinNumber, "xia4 men2 Xiamen"},
+		{"便宜", PinyinNumber, "pian2 yi"},
+		{"行", PinyinPlain, "xing"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			if got := Pinyin(tt.in, tt.style); got != tt.want {
+				t.Errorf("Pinyin(%q, %d) = %q, want %q", tt.in, tt.style, got, tt.want)
+			}
+		})
+	}
+
+	if got := PinyinInitials("张三 丰A"); got != "zsfA" {
+		t.Errorf("PinyinInitials() = %q, want zsfA", got)
+	}
+	if got := PinyinInitials("重庆银行"); got != "cqyh" {
+		t.Errorf("PinyinInitials() = %q, want cqyh", got)
+	}
+}
+
+func TestPhraseTables(t *testing.T) {
+	for word, syllables := range pinyinPhrases().words {
+		if n := len([]rune(word)); n != len(syllables) {
+			t.Errorf("pinyin of %s has %d syllables, want %d", word, len(syllables), n)
+		}
+	}
+	for _, table := range []*phrases[[]rune]{simplifiedPhrases(), traditionalPhrases()} {
+		for word, to := range table.words {
+			if len([]rune(word)) != len(to) {
+				t.Errorf("%s converts to %s of another length", word, string(to))
+			}
+		}
+	}
+}
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		name    string
+		convert func(string) string
+		in      string
+		want    string
+	}{
+		{"simplified", ToSimplified, "發展龍門", "发展龙门"},
+		{"traditional", ToTraditional, "发展龙门", "發展龍門"},
+		{"kept", ToSimplified, "abc 张三", "abc 张三"},
+		{"simplified words", ToSimplified, "乾隆時的乾燥著作", "乾隆时的干燥著作"},
+		{"traditional words", ToTraditional, "皇后的头发以后再理发", "皇后的頭髮以後再理髮"},
+		{"overlapping words", ToTraditional, "干部干净", "幹部乾淨"},
+		{"halfwidth", ToHalfwidth, "ＡＢＣ１２３，（注）　x。", "ABC123,(注) x。"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.convert(tt.in); got != tt.want {
+				t.Errorf("%s(%q) = %q, want %q", tt.name, tt.in, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package zh
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Fold normalizes text for searching: full-width forms become ASCII,
+// traditional characters simplified and letters lower case, so that ＡＢＣ,
+// abc and ABC or 發展 and 发展 are found alike. Each character maps to one
+// character, so positions in the result are positions in s.
+func Fold(s string) string {
+	return strings.ToLower(ToSimplified(ToHalfwidth(s)))
+}
+
+// Tokens splits text into the terms of a full-text index. Chinese is
+// written without spaces, so each run of Chinese characters is indexed as
+// overlapping pairs of characters, 退款失败 as 退款 款失 失败, followed by its
+// last character on its own; a lone character is indexed as itself. Other
+// words are indexed whole. Punctuation and spaces separate terms.
+func Tokens(s string) []string {
+	return tokenize(s, true)
+}
+
+// SearchTokens splits a search term like Tokens, except that the last
+// character of a run of Chinese characters is not repeated on its own, so
+// that the tokens of a term follow each other in the tokens of the text
+// containing it. A single Chinese character is still a token of its own;
+// it is found as the first character of a pair.
+func SearchTokens(s string) []string {
+	return tokenize(s, false)
+}
+
+func tokenize(s string, index bool) []string {
+	var tokens []string
+	var word strings.Builder
+	var han []rune
+	flushWord := func() {
+		if word.Len() > 0 {
+			tokens = append(tokens, word.String())
+			word.Reset()
+		}
+	}
+	flushHan := func() {
+		switch {
+		case len(han) == 1:
+			tokens = append(tokens, string(han))
+		case len(han) > 1:
+			for i := 0; i+1 < len(han); i++ {
+				tokens = append(tokens, string(han[i:i+2]))
+			}
+			if index {
+				tokens = append(tokens, string(han[len(han)-1]))
+			}
+		}
+		han = han[:0]
+	}
+
+	for _, c := range Fold(s) {
+		switch {
+		case unicode.Is(unicode.Han, c):
+			flushWord()
+			han = append(han, c)
+		case unicode.IsLetter(c) || unicode.IsDigit(c):
+			flushHan()
+			word.WriteRune(c)
+		default:
+			flushWord()
+			flushHan()
+		}
+	}
+	flushWord()
+	flushHan()
+	return tokens
+}
@@ -0,0 +1,33 @@
+package zh
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTokens(t *testing.T) {
+	tests := []struct {
+		in          string
+		index, term []string
+	}{
+		{"退款失败", []string{"退款", "款失", "失败", "败"}, []string{"退款", "款失", "失败"}},
+		{"退", []string{"退"}, []string{"退"}},
+		{"iPhone手机壳", []string{"iphone", "手机", "机壳", "壳"}, []string{"iphone", "手机", "机壳"}},
+		{"發貨，ＡＢＣ 123", []string{"发货", "货", "abc", "123"}, []string{"发货", "abc", "123"}},
+		{"，。", nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			if got := Tokens(tt.in); !reflect.DeepEqual(got, tt.index) {
+				t.Errorf("Tokens() = %q, want %q", got, tt.index)
+			}
+			if got := SearchTokens(tt.in); !reflect.DeepEqual(got, tt.term) {
+				t.Errorf("SearchTokens() = %q, want %q", got, tt.term)
+			}
+		})
+	}
+
+	if got := Fold("發貨ＡＢＣ"); got != "发货abc" {
+		t.Errorf("Fold() = %q, want 发货abc", got)
+	}
+}
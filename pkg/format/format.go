@@ -0,0 +1,161 @@
+// Package format defines how csvsql reads input files. Programs embedding
+// csvsql add their own formats with Register; built-in formats such as CSV,
+// Excel and HTML are readers of the same kind.
+package format
+
+import (
+	"fmt"
+	"io"
+	"iter"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// SniffSize is the number of leading bytes passed to Reader.Detect
+const SniffSize = 512
+
+// Reader is implemented by every input format
+type Reader interface {
+	// Name identifies the format, e.g. "csv"
+	Name() string
+	// Extensions lists the lower-case file extensions handled, e.g. ".csv"
+	Extensions() []string
+	// Detect reports whether the reader recognises a file by its leading
+	// bytes; it is only consulted when no extension matches
+	Detect(head []byte) bool
+	// Tables opens a file and returns the tables it contains
+	Tables(filePath string, opts Options) ([]*Table, error)
+}
+
+// SettingsReader is implemented by readers that claim some of their
+// extensions only with certain settings, e.g. .txt files only when a
+// fixed-width column spec is given; other readers then get the chance
+type SettingsReader interface {
+	Reader
+	// ExtensionsFor returns the extensions claimed with opts
+	ExtensionsFor(opts Options) []string
+}
+
+// Options are the import settings readers may use. Readers ignore the
+// settings of other formats.
+type Options struct {
+	Lenient    bool   // tolerate malformed rows and record them as rejects
+	FixedSpec  string // column spec (or spec file path) for fixed-width text files
+	LogPattern string // preset name or regular expression for log files
+	XMLPath    string // path of the repeating element that forms a row in XML files
+}
+
+// Table is one table of an input file
+type Table struct {
+	// Name is appended to the table name derived from the file, e.g. the
+	// position of the table in an HTML page; empty for a file's only table
+	Name string
+	// Records yields the header followed by data rows, one at a time.
+	// Iteration stops after the first error.
+	Records iter.Seq2[[]string, error]
+	// Meta describes where the table came from
+	Meta Metadata
+}
+
+// Metadata describes the origin of a table
+type Metadata struct {
+	Format string // name of the reader
+	Source string // file path
+	Detail string // format specific location, e.g. sheet name or row path
+	// Rejects lists rows that were repaired or skipped; it is complete
+	// once Records has been consumed
+	Rejects []Reject
+}
+
+// Reject is a row of an input file that could not be loaded as is
+type Reject struct {
+	Line    int
+	Raw     string
+	Reason  string
+	Skipped bool // the row was dropped rather than repaired
+}
+
+// Registry holds the readers available for loading files
+type Registry struct {
+	mu      sync.RWMutex
+	readers []Reader
+}
+
+// NewRegistry creates a registry with the given readers
+func NewRegistry(readers ...Reader) *Registry {
+	return &Registry{readers: readers}
+}
+
+// Register adds a reader. Readers registered later take precedence, so a
+// custom reader can replace a built-in one for the same extension.
+func (r *Registry) Register(reader Reader) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.readers = append(r.readers, reader)
+}
+
+// Readers returns the registered readers in registration order
+func (r *Registry) Readers() []Reader {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return slices.Clone(r.readers)
+}
+
+// Lookup finds the reader for a file, first by extension and then by
+// sniffing its leading bytes
+func (r *Registry) Lookup(filePath string, opts Options) (Reader, error) {
+	readers := r.Readers()
+	slices.Reverse(readers)
+
+	ext := strings.ToLower(filepath.Ext(filePath))
+	for _, reader := range readers {
+		extensions := reader.Extensions()
+		if sr, ok := reader.(SettingsReader); ok {
+			extensions = sr.ExtensionsFor(opts)
+		}
+		if slices.Contains(extensions, ext) {
+			return reader, nil
+		}
+	}
+
+	head, err := ReadHead(filePath)
+	if err != nil {
+		return nil, err
+	}
+	for _, reader := range readers {
+		if reader.Detect(head) {
+			return reader, nil
+		}
+	}
+
+	return nil, fmt.Errorf("unsupported file type: %s", filePath)
+}
+
+// Default holds the readers added with Register. They are used, ahead of
+// the built-in readers, by processors created after they are registered.
+var Default = NewRegistry()
+
+// Register adds a reader to Default
+func Register(reader Reader) {
+	Default.Register(reader)
+}
+
+// ReadHead returns up to SniffSize leading bytes of a file, as passed to
+// Reader.Detect
+func ReadHead(filePath string) ([]byte, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	head := make([]byte, SniffSize)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	return head[:n], nil
+}
@@ -0,0 +1,24 @@
+package utils
+
+import (
+	"golang.org/x/text/width"
+)
+
+// RuneWidth returns the number of terminal columns a character occupies.
+// East Asian wide and full-width characters take two columns.
+func RuneWidth(r rune) int {
+	switch width.LookupRune(r).Kind() {
+	case width.EastAsianWide, width.EastAsianFullwidth:
+		return 2
+	}
+	return 1
+}
+
+// StringWidth returns the number of terminal columns a string occupies
+func StringWidth(s string) int {
+	w := 0
+	for _, r := range s {
+		w += RuneWidth(r)
+	}
+	return w
+}